@@ -0,0 +1,166 @@
+package gshell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// aliases holds the aliases defined with the `alias` builtin, shared by every
+// view of a shell. An alias expands to a command line, and is saved to file
+// on every change unless file is empty.
+type aliases struct {
+	mu      sync.RWMutex
+	aliases map[string]string
+	file    string
+}
+
+// loadAliases reads the aliases saved to file, one `name=expansion` per line.
+// A missing file holds no aliases. Invalid lines are skipped and reported in
+// the returned error along with the aliases of the other lines.
+func loadAliases(file string) (*aliases, error) {
+	a := &aliases{aliases: make(map[string]string), file: file}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return a, err
+	}
+	defer f.Close()
+
+	var errs []error
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		name, expansion, ok := strings.Cut(line, "=")
+		if !ok || !isValidAliasName(name) {
+			errs = append(errs, fmt.Errorf("%s:%d: invalid alias: %s", file, lineNo, line))
+			continue
+		}
+		a.aliases[name] = expansion
+	}
+
+	return a, errors.Join(append(errs, scanner.Err())...)
+}
+
+// clone copies the aliases without saving them, for a script running in a
+// child scope.
+func (a *aliases) clone() *aliases {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return &aliases{aliases: maps.Clone(a.aliases)}
+}
+
+func (a *aliases) get(name string) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	expansion, ok := a.aliases[name]
+	return expansion, ok
+}
+
+func (a *aliases) names() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0, len(a.aliases))
+	for name := range a.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *aliases) set(name, expansion string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.aliases[name] = expansion
+	return a.save()
+}
+
+// remove deletes the alias, ok is false if it did not exist.
+func (a *aliases) remove(name string) (ok bool, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.aliases[name]; !ok {
+		return false, nil
+	}
+
+	delete(a.aliases, name)
+	return true, a.save()
+}
+
+// save writes the aliases to file, it must be called with the lock held.
+func (a *aliases) save() error {
+	if a.file == "" {
+		return nil
+	}
+
+	var sb strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(a.aliases)) {
+		sb.WriteString(name + "=" + a.aliases[name] + "\n")
+	}
+	return os.WriteFile(a.file, []byte(sb.String()), 0644)
+}
+
+// isValidAliasName rejects names the lexer would not read back as a single
+// word.
+func isValidAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\n=;&|<>'\"$\\`#")
+}
+
+// aliasParamPattern finds the positional parameters of an expansion, like $1
+// or ${2}, that take the arguments of the alias.
+var aliasParamPattern = regexp.MustCompile(`\$\{?[0-9@#]`)
+
+// alias returns the expansion of an alias, unless the alias is already being
+// expanded so that `alias ls "ls --all"` runs the ls command.
+func (sh *Shell) alias(name string) (string, bool) {
+	if slices.Contains(sh.expanding, name) {
+		return "", false
+	}
+	return sh.aliases.get(name)
+}
+
+// runAlias runs the command line an alias expands to. The arguments fill the
+// positional parameters used by the expansion, or are appended to it if it
+// uses none.
+func (sh *Shell) runAlias(name, expansion string, args []string) (Status, error) {
+	view := *sh
+	view.expanding = append(slices.Clip(sh.expanding), name)
+
+	line := expansion
+	if aliasParamPattern.MatchString(expansion) {
+		view = *view.withFrame(args)
+	} else {
+		for _, arg := range args {
+			line += " " + quoteArg(arg)
+		}
+	}
+
+	list, err := parse(line)
+	if err != nil {
+		err = fmt.Errorf("alias %s: %s", name, err)
+		sh.Error(SHELL_PREFIX, err.Error())
+		sh.logger.Error(SHELL_PREFIX, err.Error())
+		return FAIL, err
+	}
+
+	return view.runList(list)
+}
@@ -0,0 +1,90 @@
+package gshell
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+		stat Status
+	}{
+		{"alias hi 'echo hi'; hi", "hi\n", OK},
+		{"alias hi 'echo hi'; hi there", "hi there\n", OK},
+		{"alias hi echo hi; hi 'a  b'", "hi a  b\n", OK},
+		{"alias hi 'echo hi $1!'; hi bob", "hi bob!\n", OK},
+		{"alias two 'echo $2 $1'; two a b", "b a\n", OK},
+		{"alias all 'echo $# $@'; all a b", "2 a b\n", OK},
+		{"alias both 'echo not both'; both", "not both\n", OK},
+		{"alias echo 'echo -'; echo a", "- a\n", OK},
+		{"alias a 'echo a; echo b'; a", "a\nb\n", OK},
+		{"alias ok 'echo a && fail || echo b'; ok", "a\nb\n", OK},
+		{"alias hi 'echo hi'; alias hey hi; hey", "hi\n", OK},
+		{"alias f fail; f || echo a", "a\n", OK},
+		{"alias hi 'echo hi'; alias hi", "hi=echo hi\n", OK},
+		{"alias b 'echo b'; alias a 'echo a'; alias", "a=echo a\nb=echo b\n", OK},
+		{"alias hi 'echo hi'; unalias hi; hi", "", NOT_FOUND},
+		{"alias hi", "", FAIL},
+		{"alias 'a b' echo", "", FAIL},
+		{"alias a=b echo", "", FAIL},
+		{"alias bad 'echo a &&'; bad", "", FAIL},
+	}
+
+	for _, tt := range tests {
+		sh, out, _ := newTestShell(t)
+
+		stat, _ := sh.Exec(tt.line)
+		if stat != tt.stat || out.String() != tt.out {
+			t.Errorf("%s: got %s with output %q, want %s with output %q", tt.line, stat, out.String(), tt.stat, tt.out)
+		}
+	}
+}
+
+func TestAliasesSaved(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "aliases")
+
+	sh, _, _ := newTestShell(t, WithAliasFile(file))
+	sh.Exec("alias hi 'echo hi $1'; alias bye echo bye; alias tmp echo; unalias tmp")
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bye=echo bye\nhi=echo hi $1\n"; string(content) != want {
+		t.Errorf("got file %q, want %q", content, want)
+	}
+
+	sh, out, _ := newTestShell(t, WithAliasFile(file))
+	sh.Exec("hi bob; bye")
+	if want := "hi bob\nbye\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+}
+
+func TestLoadAliases(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "aliases")
+	content := "a=echo a\n\nno equal sign\nb c=echo\nb=echo b=c\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := loadAliases(file)
+	if err == nil || !strings.Contains(err.Error(), file+":3: invalid alias") || !strings.Contains(err.Error(), file+":4: invalid alias") {
+		t.Errorf("got error %v, want the lines 3 and 4 reported", err)
+	}
+	if names := a.names(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("got aliases %q, want a and b", names)
+	}
+	if expansion, _ := a.get("b"); expansion != "echo b=c" {
+		t.Errorf("got expansion %q, want %q", expansion, "echo b=c")
+	}
+
+	if _, err := loadAliases(filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("got error %v for a missing file", err)
+	}
+}
@@ -1,7 +1,22 @@
 package gshell
 
+import (
+	"slices"
+	"time"
+)
+
 type ArgType string
 
+const (
+	ARG_STRING   ArgType = "string"
+	ARG_INT      ArgType = "int"
+	ARG_FLOAT    ArgType = "float"
+	ARG_BOOL     ArgType = "bool"
+	ARG_DURATION ArgType = "duration" // Parsed by time.ParseDuration, like 1m30s
+	ARG_PATH     ArgType = "path"
+	ARG_ENUM     ArgType = "enum" // One of Argument.Enum
+)
+
 const (
 	EMPTY_TAG = ""
 )
@@ -11,9 +26,17 @@ type Command struct {
 	Description  string
 	Usage        string
 	Args         []Argument
+	Flags        []Flag
 	Aliases      []string
 	Handler      func(s *Shell, args []string) (Status, error)
+	Run          func(inv *Invocation) (Status, error) // Used instead of Handler when set
 	ValidateArgs func(args []string) (bool, error)
+	Subcommands  []*Command    // A command without Handler or Run only groups its subcommands
+	Timeout      time.Duration // Cancels the context of the handler, zero uses the shell default, negative disables it
+	// Complete computes the completions of the args that have no Complete of
+	// their own, prior are the positional args typed before the completed one
+	Complete func(sh *Shell, prefix string, prior []string) []string
+	parent   *Command
 }
 
 type EarlyCommand struct {
@@ -31,6 +54,24 @@ type Argument struct {
 	Required    bool
 	Type        ArgType
 	Default     string
+	Enum        []string // Accepted values of an ARG_ENUM argument
+	Variadic    bool     // Only for the last argument, takes all the remaining args
+	// Path restricts the values of an ARG_PATH argument, which is completed
+	// with the entries of the directory typed so far
+	Path PathOptions
+	// Complete computes the completions of the argument when tab is pressed,
+	// prior are the positional args typed before it
+	Complete func(sh *Shell, prefix string, prior []string) []string
+}
+
+// PathOptions restrict the paths accepted and completed for an ARG_PATH
+// argument. Directories are always completed, so that the files they hold
+// can be reached.
+type PathOptions struct {
+	FilesOnly  bool     // Rejects a directory
+	DirsOnly   bool     // Rejects a file, and only completes directories
+	Exists     bool     // Rejects a path that does not exist
+	Extensions []string // Rejects and does not complete the files without one of these extensions, like ".shell"
 }
 
 func (arg *Argument) String() string {
@@ -95,3 +136,48 @@ func NewEarlyCommand(
 func (cmd *Command) AddAlias(alias string) {
 	cmd.Aliases = append(cmd.Aliases, alias)
 }
+
+// AddSubcommand nests sub under cmd, so that `cmd sub args...` runs sub.
+func (cmd *Command) AddSubcommand(sub *Command) {
+	sub.parent = cmd
+	cmd.Subcommands = append(cmd.Subcommands, sub)
+}
+
+// FullName returns the names of the command and its parents, like `user add`.
+func (cmd *Command) FullName() string {
+	if cmd.parent == nil {
+		return cmd.Name
+	}
+	return cmd.parent.FullName() + " " + cmd.Name
+}
+
+func (cmd *Command) findSubcommand(nameOrAlias string) (*Command, bool) {
+	for _, sub := range cmd.Subcommands {
+		if sub.Name == nameOrAlias || slices.Contains(sub.Aliases, nameOrAlias) {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+// resolveSubcommand follows the subcommands named by the leading args and
+// returns the deepest one found with the args left for it.
+func (cmd *Command) resolveSubcommand(args []string) (*Command, []string) {
+	for len(args) > 0 {
+		sub, ok := cmd.findSubcommand(args[0])
+		if !ok {
+			break
+		}
+		cmd, args = sub, args[1:]
+	}
+	return cmd, args
+}
+
+// linkSubcommands sets the parent of subcommands declared in a struct literal
+// instead of with AddSubcommand.
+func (cmd *Command) linkSubcommands() {
+	for _, sub := range cmd.Subcommands {
+		sub.parent = cmd
+		sub.linkSubcommands()
+	}
+}
@@ -0,0 +1,400 @@
+package gshell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// completer completes the word under the cursor when tab is pressed. A single
+// candidate is completed in full, several candidates are completed up to
+// their longest common prefix, and pressing tab again lists them with their
+// description.
+type completer struct {
+	shell     *Shell
+	out       io.Writer // Where the list of candidates is written
+	lastInput string
+}
+
+// candidate is a possible completion of the word under the cursor.
+type candidate struct {
+	value       string
+	description string
+}
+
+// Do implements readline.AutoCompleter, it returns the text to insert at the
+// cursor.
+func (c *completer) Do(line []rune, pos int) ([][]rune, int) {
+	input := string(line[:pos])
+	words, prefix, quote, redirect := splitCompletionLine(input)
+
+	var candidates []candidate
+	if redirect {
+		candidates = completePath(prefix, PathOptions{})
+	} else {
+		candidates = c.shell.completions(words, prefix)
+	}
+
+	repeated := input == c.lastInput
+	c.lastInput = input
+
+	if len(candidates) == 0 {
+		return nil, 0
+	}
+
+	if len(candidates) == 1 {
+		value := candidates[0].value
+		suffix := escapeCompletion(value[len(prefix):], quote)
+		if !strings.HasSuffix(value, "/") {
+			if quote != 0 {
+				suffix += string(quote)
+			}
+			suffix += " "
+		}
+		return [][]rune{[]rune(suffix)}, len([]rune(prefix))
+	}
+
+	if common := commonPrefix(candidates); len(common) > len(prefix) {
+		return [][]rune{[]rune(escapeCompletion(common[len(prefix):], quote))}, len([]rune(prefix))
+	}
+
+	if repeated {
+		c.showCandidates(candidates)
+	}
+	return nil, 0
+}
+
+// showCandidates lists the candidates above the prompt, one per line with
+// their description.
+func (c *completer) showCandidates(candidates []candidate) {
+	if c.out == nil {
+		return
+	}
+
+	width := 0
+	for _, cand := range candidates {
+		width = max(width, len(cand.value))
+	}
+
+	var sb strings.Builder
+	for _, cand := range candidates {
+		if cand.description == "" {
+			sb.WriteString(cand.value + "\n")
+			continue
+		}
+		fmt.Fprintf(&sb, "%-*s  %s\n", width, cand.value, cand.description)
+	}
+	_, _ = c.out.Write([]byte(sb.String()))
+}
+
+// completions returns the sorted candidates for the word starting with prefix
+// that follows words in a command.
+func (sh *Shell) completions(words []string, prefix string) []candidate {
+	var candidates []candidate
+	add := func(value, description string) {
+		if strings.HasPrefix(value, prefix) {
+			candidates = append(candidates, candidate{value: value, description: description})
+		}
+	}
+
+	if len(words) == 0 {
+		for name, cmd := range sh.commands {
+			add(name, cmd.Description)
+		}
+		for alias, name := range sh.rootCommand {
+			add(alias, "Alias for "+name)
+		}
+		for _, name := range sh.aliases.names() {
+			expansion, _ := sh.aliases.get(name)
+			add(name, "Alias for "+expansion)
+		}
+		sh.funcs.mu.RLock()
+		for name := range sh.funcs.funcs {
+			add(name, "Function")
+		}
+		sh.funcs.mu.RUnlock()
+
+		return sortCandidates(candidates)
+	}
+
+	command, rest, ok := sh.resolveCommand(words[0], words[1:])
+	if !ok {
+		return nil
+	}
+
+	positional, pending := splitFlags(command.Flags, rest)
+	if pending != nil {
+		if pending.Complete != nil {
+			for _, value := range pending.Complete(sh, prefix, positional) {
+				add(value, "")
+			}
+		}
+		return sortCandidates(candidates)
+	}
+
+	if strings.HasPrefix(prefix, "-") {
+		if name, value, ok := strings.Cut(strings.TrimPrefix(prefix, "--"), "="); ok {
+			if flag := findFlag(command.Flags, name); flag != nil && flag.Complete != nil {
+				for _, v := range flag.Complete(sh, value, positional) {
+					add("--"+name+"="+v, "")
+				}
+			}
+			return sortCandidates(candidates)
+		}
+
+		for _, flag := range command.Flags {
+			add("--"+flag.Name, flag.Description)
+		}
+		return sortCandidates(candidates)
+	}
+
+	if len(rest) == 0 {
+		for _, sub := range command.Subcommands {
+			add(sub.Name, sub.Description)
+		}
+	}
+
+	arg, ok := argumentAt(command.Args, len(positional))
+	switch {
+	case ok && arg.Complete != nil:
+		for _, value := range arg.Complete(sh, prefix, positional) {
+			add(value, "")
+		}
+	case command.Complete != nil:
+		for _, value := range command.Complete(sh, prefix, positional) {
+			add(value, "")
+		}
+	case ok && arg.Type == ARG_PATH:
+		candidates = completePath(prefix, arg.Path)
+	case ok:
+		if arg.Tag != EMPTY_TAG {
+			add(arg.Tag, arg.Description)
+		}
+		for _, value := range arg.Enum {
+			add(value, arg.Description)
+		}
+	}
+
+	return sortCandidates(candidates)
+}
+
+// splitFlags returns the positional args among the args typed for a command,
+// and the flag taking the value being completed if the last arg is a flag
+// missing its value.
+func splitFlags(flags []Flag, args []string) (positional []string, pending *Flag) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		var valueFlag *Flag
+		switch {
+		case arg == "--":
+			return append(positional, args[i+1:]...), nil
+		case strings.HasPrefix(arg, "--"):
+			if flag := findFlag(flags, arg[2:]); flag != nil && flag.Type != FLAG_BOOL {
+				valueFlag = flag
+			}
+		case len(arg) > 1 && arg[0] == '-' && !isDigit(rune(arg[1])):
+			group := arg[1:]
+			for j, short := range group {
+				flag := findFlag(flags, string(short))
+				if flag != nil && flag.Type != FLAG_BOOL {
+					if group[j+1:] == "" {
+						valueFlag = flag
+					}
+					break
+				}
+			}
+		default:
+			positional = append(positional, arg)
+		}
+
+		if valueFlag != nil {
+			if i+1 == len(args) {
+				return positional, valueFlag
+			}
+			i++
+		}
+	}
+
+	return positional, nil
+}
+
+// completePath lists the entries of the directory typed so far in prefix,
+// where a leading ~ stands for the home directory. Directories end with a / so
+// that completing them moves on to their entries, hidden entries are only
+// listed once their leading dot is typed.
+func completePath(prefix string, opts PathOptions) []candidate {
+	if prefix == "~" {
+		return []candidate{{value: "~/"}}
+	}
+
+	i := strings.LastIndex(prefix, "/") + 1
+	dir, base := prefix[:i], prefix[i:]
+
+	readDir := expandHome(dir)
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []candidate
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+
+		switch {
+		case isDir:
+			candidates = append(candidates, candidate{value: dir + name + "/"})
+		case opts.DirsOnly:
+		case len(opts.Extensions) > 0 && !slices.Contains(opts.Extensions, filepath.Ext(name)):
+		default:
+			candidates = append(candidates, candidate{value: dir + name})
+		}
+	}
+
+	return sortCandidates(candidates)
+}
+
+// argumentAt returns the argument declared for the positional arg at index i,
+// the last argument takes every remaining arg if it is variadic.
+func argumentAt(args []Argument, i int) (Argument, bool) {
+	if i < len(args) {
+		return args[i], true
+	}
+	if n := len(args); n > 0 && args[n-1].Variadic {
+		return args[n-1], true
+	}
+	return Argument{}, false
+}
+
+// sortCandidates sorts the candidates by value and drops duplicate values.
+func sortCandidates(candidates []candidate) []candidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].value < candidates[j].value
+	})
+
+	var unique []candidate
+	for i, cand := range candidates {
+		if i == 0 || cand.value != candidates[i-1].value {
+			unique = append(unique, cand)
+		}
+	}
+	return unique
+}
+
+func commonPrefix(candidates []candidate) string {
+	common := []rune(candidates[0].value)
+	for _, cand := range candidates[1:] {
+		value := []rune(cand.value)
+		n := 0
+		for n < len(common) && n < len(value) && common[n] == value[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return string(common)
+}
+
+// splitCompletionLine reads the command under the cursor from the line typed
+// so far: the words before the one being completed, the unquoted prefix of
+// that word, the quote it leaves open, if any, and whether it is the target of
+// a redirection. The words of the commands before a ;, & or | are dropped, as
+// are the targets of redirections.
+func splitCompletionLine(line string) (words []string, prefix string, quote rune, redirect bool) {
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord && !redirect {
+			words = append(words, word.String())
+		}
+		if inWord {
+			redirect = false
+		}
+		word.Reset()
+		inWord = false
+	}
+
+	rs := []rune(line)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '\'':
+			word.WriteRune(r)
+		case r == '\\' && i+1 < len(rs) && (quote == 0 || strings.ContainsRune("$`\"\\", rs[i+1])):
+			i++
+			word.WriteRune(rs[i])
+			inWord = true
+		case quote == '"':
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			endWord()
+		case r == '<' || r == '>':
+			if r == '>' && inWord && word.String() == "2" {
+				word.Reset()
+				inWord = false
+			}
+			endWord()
+
+			redirect = true
+			switch {
+			case r == '>' && i+2 < len(rs) && rs[i+1] == '&' && rs[i+2] == '1':
+				i += 2
+				redirect = false
+			case r == '>' && i+1 < len(rs) && rs[i+1] == '>':
+				i++
+			}
+		case strings.ContainsRune(";&|\n", r):
+			endWord()
+			words, redirect = nil, false
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	return words, word.String(), quote, redirect
+}
+
+// escapeCompletion escapes the completed text so that the lexer reads it
+// back unchanged, inside the quote left open by the user if any.
+func escapeCompletion(s string, quote rune) string {
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(s, "'", `'\''`)
+	case '"':
+		return escapeChars(s, "$`\"\\")
+	}
+	return escapeChars(s, " \t'\"\\$;&|<>#`()")
+}
+
+func escapeChars(s, chars string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
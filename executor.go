@@ -0,0 +1,337 @@
+package gshell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// runList executes every and-or list in order, stopping only on EXIT or when
+// interrupted. The status and error of the last executed command are
+// returned, starting a background job always succeeds.
+func (sh *Shell) runList(list *commandList) (Status, error) {
+	stat, err := OK, error(nil)
+	for _, item := range list.items {
+		if item.background {
+			j := sh.startJob(item)
+			sh.Write(fmt.Sprintf("[%d] %s\n", j.id, j.line))
+			stat, err = OK, nil
+			continue
+		}
+
+		stat, err = sh.runAndOr(item)
+		if stat == EXIT || stat == INTERRUPTED || sh.returning() {
+			return stat, err
+		}
+	}
+
+	return stat, err
+}
+
+// runAndOr executes a chain of pipelines joined by && and ||, a pipeline
+// after && only runs if the previous status is OK, and a pipeline after ||
+// only runs if it is not. Skipped pipelines keep the previous status so that
+// `a && b || c` runs c when a fails. The status of every pipeline is recorded
+// for $? and the status builtin.
+func (sh *Shell) runAndOr(andOr *andOrList) (Status, error) {
+	stat, err := sh.runPipeline(andOr.pipelines[0])
+	sh.last.set(stat, err)
+	last := len(andOr.ops) == 0
+
+	for i, op := range andOr.ops {
+		if stat == EXIT || stat == INTERRUPTED || sh.returning() {
+			return stat, err
+		}
+
+		if (op == tokAnd) != (stat == OK) {
+			continue
+		}
+
+		stat, err = sh.runPipeline(andOr.pipelines[i+1])
+		sh.last.set(stat, err)
+		last = i == len(andOr.ops)-1
+	}
+
+	sh.checkFailure(andOr, last, stat, err)
+	return stat, err
+}
+
+// runPipeline runs every command of the pipeline concurrently, each on its own
+// view of the shell whose output stream is the input stream of the next
+// command. The status of the pipeline is the status of its last command.
+// Every command writes its errors, and the last one its output, to the
+// streams of the shell, which are locked so that they can be shared.
+func (sh *Shell) runPipeline(pl *pipeline) (Status, error) {
+	if len(pl.commands) == 1 {
+		return sh.runNode(pl.commands[0])
+	}
+
+	outStream := &syncWriter{w: sh.outStream}
+	errStream := io.Writer(&syncWriter{w: sh.errStream})
+	if sh.errStream == sh.outStream {
+		errStream = outStream
+	}
+
+	var wg sync.WaitGroup
+	statuses := make([]Status, len(pl.commands))
+	errs := make([]error, len(pl.commands))
+	in := sh.inStream
+
+	for i, cmd := range pl.commands {
+		stage := sh.withStreams(in, outStream, errStream)
+
+		var next *io.PipeReader
+		var out *io.PipeWriter
+		if i < len(pl.commands)-1 {
+			next, out = io.Pipe()
+			stage.outStream = out
+		}
+
+		wg.Add(1)
+		go func(i int, stage *Shell, out *io.PipeWriter) {
+			defer wg.Done()
+
+			statuses[i], errs[i] = stage.runNode(cmd)
+
+			// Signal EOF to the next command, and unblock the previous one
+			// in case this command stopped reading before its input ended.
+			if out != nil {
+				_ = out.Close()
+			}
+			if i > 0 {
+				_ = stage.inStream.Close()
+			}
+		}(i, stage, out)
+
+		in = next
+	}
+
+	wg.Wait()
+	return statuses[len(statuses)-1], errs[len(errs)-1]
+}
+
+func (sh *Shell) runNode(node commandNode) (Status, error) {
+	switch node := node.(type) {
+	case *simpleCommand:
+		return sh.runSimple(node)
+	case *ifClause:
+		return sh.runIf(node)
+	case *forClause:
+		return sh.runFor(node)
+	case *whileClause:
+		return sh.runWhile(node)
+	case *funcDef:
+		sh.defineFunction(node)
+		return OK, nil
+	}
+
+	panic(fmt.Sprintf("unknown command node %T", node))
+}
+
+func (sh *Shell) runSimple(cmd *simpleCommand) (Status, error) {
+	words, err := sh.expandWords(cmd.words)
+	if err != nil {
+		sh.Error(SHELL_PREFIX, err.Error())
+		sh.logger.Error(SHELL_PREFIX, "Expansion failed: "+err.Error())
+		return FAIL, err
+	}
+	if len(words) == 0 {
+		return OK, nil
+	}
+	sh.trace(words)
+	commandOrAlias, args := words[0], words[1:]
+
+	view, closeFiles, err := sh.redirect(cmd.redirects)
+	if err != nil {
+		sh.Error(SHELL_PREFIX, err.Error())
+		sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Redirection failed for command %s: %s", commandOrAlias, err))
+		return FAIL, err
+	}
+	defer closeFiles()
+
+	if commandOrAlias == "return" {
+		return view.returnFromFrame(args)
+	}
+	if expansion, ok := view.alias(commandOrAlias); ok {
+		return view.runAlias(commandOrAlias, expansion, args)
+	}
+	if fn, ok := view.function(commandOrAlias); ok {
+		return view.callFunction(fn, args)
+	}
+	return view.runCommand(commandOrAlias, args)
+}
+
+// runIf runs the body of the first condition that succeeds. Its status is the
+// status of that body, or OK when no body ran.
+func (sh *Shell) runIf(clause *ifClause) (Status, error) {
+	for i, cond := range clause.conds {
+		stat, err := sh.asCondition().runList(cond)
+		if stat == EXIT || stat == INTERRUPTED || sh.returning() {
+			return stat, err
+		}
+
+		if stat == OK {
+			return sh.runList(clause.bodies[i])
+		}
+	}
+
+	if clause.elseBody != nil {
+		return sh.runList(clause.elseBody)
+	}
+	return OK, nil
+}
+
+// runFor runs the body for each word, unquoted words are split on spaces so
+// that `for x in $(list)` iterates over every listed item, and $@ gives one
+// item per positional parameter.
+func (sh *Shell) runFor(clause *forClause) (Status, error) {
+	var values []string
+	if clause.params {
+		values = sh.params()
+	}
+	for _, w := range clause.words {
+		if isParamsWord(w) {
+			values = append(values, sh.params()...)
+			continue
+		}
+
+		value, ok, err := sh.expandWord(w)
+		switch {
+		case err != nil:
+			sh.Error(SHELL_PREFIX, err.Error())
+			sh.logger.Error(SHELL_PREFIX, "Expansion failed: "+err.Error())
+			return FAIL, err
+		case !ok:
+		case w.quoted:
+			values = append(values, value)
+		default:
+			values = append(values, strings.Fields(value)...)
+		}
+	}
+
+	stat, err := OK, error(nil)
+	for _, value := range values {
+		if sh.Context().Err() != nil {
+			return cancelledStatus(sh.Context()), sh.Context().Err()
+		}
+
+		sh.SetVar(clause.name, value)
+		stat, err = sh.runList(clause.body)
+		if stat == EXIT || stat == INTERRUPTED || sh.returning() {
+			return stat, err
+		}
+	}
+
+	return stat, err
+}
+
+// runWhile runs the body as long as the condition succeeds.
+func (sh *Shell) runWhile(clause *whileClause) (Status, error) {
+	stat, err := OK, error(nil)
+	for {
+		if sh.Context().Err() != nil {
+			return cancelledStatus(sh.Context()), sh.Context().Err()
+		}
+
+		condStat, condErr := sh.asCondition().runList(clause.cond)
+		if condStat == EXIT || condStat == INTERRUPTED || sh.returning() {
+			return condStat, condErr
+		}
+		if condStat != OK {
+			return stat, err
+		}
+
+		stat, err = sh.runList(clause.body)
+		if stat == EXIT || stat == INTERRUPTED || sh.returning() {
+			return stat, err
+		}
+	}
+}
+
+// runCommand executes a single command and reports why it failed or was not
+// found. The usage of a command failing in the condition of an if or a while
+// is not shown, only its status matters there, nor is the usage of a command
+// that already reported its failure.
+func (sh *Shell) runCommand(commandOrAlias string, args []string) (Status, error) {
+	stat, err := sh.executeCommand(commandOrAlias, args)
+	switch stat {
+	case FAIL:
+		command, _, found := sh.resolveCommand(commandOrAlias, args)
+		switch {
+		case !found:
+			sh.handleCommandOrAliasNotFound(commandOrAlias, args)
+		case !sh.condition && !isReported(err):
+			sh.Error(SHELL_PREFIX, "Command failed, Usage: "+command.Usage)
+		}
+	case NOT_FOUND:
+		sh.handleCommandOrAliasNotFound(commandOrAlias, args)
+	}
+
+	return stat, err
+}
+
+// redirect opens the files of the given redirections in order and returns a
+// view of the shell using them as its streams, together with a function
+// closing every opened file.
+func (sh *Shell) redirect(redirects []redirect) (*Shell, func(), error) {
+	if len(redirects) == 0 {
+		return sh, func() {}, nil
+	}
+
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}
+
+	view := sh.withStreams(sh.inStream, sh.outStream, sh.errStream)
+	for _, r := range redirects {
+		if r.op == "2>&1" {
+			view.errStream = view.outStream
+			continue
+		}
+
+		target, ok, err := sh.expandWord(r.target)
+		if err != nil {
+			closeFiles()
+			return nil, nil, err
+		}
+		if !ok {
+			closeFiles()
+			return nil, nil, fmt.Errorf("ambiguous redirect %s", r.op)
+		}
+
+		target = expandHome(target)
+
+		var f *os.File
+
+		switch r.op {
+		case "<":
+			f, err = os.Open(target)
+		case ">", "2>":
+			f, err = os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		case ">>", "2>>":
+			f, err = os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		}
+
+		if err != nil {
+			closeFiles()
+			return nil, nil, fmt.Errorf("cannot redirect %s %s: %s", r.op, target, err)
+		}
+		files = append(files, f)
+
+		switch r.op {
+		case "<":
+			view.inStream = f
+		case ">", ">>":
+			view.outStream = f
+		default:
+			view.errStream = f
+		}
+	}
+
+	return view, closeFiles, nil
+}
@@ -0,0 +1,152 @@
+package gshell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAndOrLists(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+		stat Status
+	}{
+		{"echo a; echo b", "a\nb\n", OK},
+		{"echo a; fail", "a\n", FAIL},
+		{"fail; echo a", "a\n", OK},
+		{"echo a && echo b", "a\nb\n", OK},
+		{"fail && echo a", "", FAIL},
+		{"echo a || echo b", "a\n", OK},
+		{"fail || echo a", "a\n", OK},
+		{"fail || fail", "", FAIL},
+		{"echo a && fail || echo b", "a\nb\n", OK},
+		{"fail && echo a || echo b", "b\n", OK},
+		{"fail || echo a && echo b", "a\nb\n", OK},
+		{"echo a || echo b && echo c", "a\nc\n", OK},
+		{"fail && echo a; echo b", "b\n", OK},
+		{"nosuchcommand || echo a", "a\n", OK},
+		{"nosuchcommand", "", NOT_FOUND},
+	}
+
+	for _, tt := range tests {
+		sh, out, _ := newTestShell(t)
+
+		stat, _ := sh.Exec(tt.line)
+		if stat != tt.stat || out.String() != tt.out {
+			t.Errorf("%s: got %s with output %q, want %s with output %q", tt.line, stat, out.String(), tt.stat, tt.out)
+		}
+	}
+}
+
+func TestRedirections(t *testing.T) {
+	tests := []struct {
+		line   string
+		out    string // Written to the output stream of the shell
+		errOut string // Written to the error stream of the shell
+		file   string // Written to the file named f
+	}{
+		{"both > f", "", "err\n", "out\n"},
+		{"both 2> f", "out\n", "", "err\n"},
+		{"both > f 2>&1", "", "", "out\nerr\n"},
+		{"both 2>&1 > f", "err\n", "", "out\n"},
+		{"both >> f; both >> f", "", "err\nerr\n", "out\nout\n"},
+		{"echo a > f; echo b > f", "", "", "b\n"},
+		{"echo a > f; echo b < f", "b\n", "", "a\n"},
+	}
+
+	for _, tt := range tests {
+		sh, out, errOut := newTestShell(t)
+		file := filepath.Join(t.TempDir(), "f")
+
+		line := strings.ReplaceAll(tt.line, " f", " "+quoteArg(file))
+		if stat, err := sh.Exec(line); stat != OK {
+			t.Errorf("%s: got %s (%v), want OK", tt.line, stat, err)
+			continue
+		}
+
+		content, _ := os.ReadFile(file)
+		if out.String() != tt.out || errOut.String() != tt.errOut || string(content) != tt.file {
+			t.Errorf("%s: got output %q, error %q and file %q, want %q, %q and %q",
+				tt.line, out.String(), errOut.String(), content, tt.out, tt.errOut, tt.file)
+		}
+	}
+}
+
+func TestPipelines(t *testing.T) {
+	tests := []struct {
+		line   string
+		out    string
+		errOut string
+		stat   Status
+	}{
+		{"echo a | echo b", "b\n", "", OK},
+		{"echo a | fail", "", "", FAIL},
+		{"fail | echo a", "a\n", "", OK},
+		{"both | both | both", "out\n", "err\nerr\nerr\n", OK},
+		{"exec echo hi | exec tr a-z A-Z", "HI\n", "", OK},
+		{"exec echo hi | exec tr a-z A-Z | exec tr H J", "JI\n", "", OK},
+	}
+
+	for _, tt := range tests {
+		sh, out, errOut := newTestShell(t)
+
+		stat, _ := sh.Exec(tt.line)
+		if stat != tt.stat || out.String() != tt.out {
+			t.Errorf("%s: got %s with output %q, want %s with output %q", tt.line, stat, out.String(), tt.stat, tt.out)
+		}
+		if tt.errOut != "" && errOut.String() != tt.errOut {
+			t.Errorf("%s: got errors %q, want %q", tt.line, errOut.String(), tt.errOut)
+		}
+	}
+}
+
+// TestPipelineErrors runs commands reporting their failure concurrently, the
+// race detector checks that the error stream they share is locked.
+func TestPipelineErrors(t *testing.T) {
+	sh, _, errOut := newTestShell(t)
+
+	stat, _ := sh.Exec("fail | fail | fail")
+	if stat != FAIL {
+		t.Errorf("got %s, want %s", stat, FAIL)
+	}
+	if n := strings.Count(errOut.String(), "failed"); n < 3 {
+		t.Errorf("got %d errors in %q, want 3", n, errOut.String())
+	}
+}
+
+func TestControlFlow(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+		stat Status
+	}{
+		{"if echo a; then echo b; fi", "a\nb\n", OK},
+		{"if fail; then echo a; fi", "", OK},
+		{"if fail; then echo a; else echo b; fi", "b\n", OK},
+		{"if fail; then echo a; elif echo b; then echo c; else echo d; fi", "b\nc\n", OK},
+		{"if echo a; then fail; fi", "a\n", FAIL},
+		{"for x in a b c; do echo $x; done", "a\nb\nc\n", OK},
+		{"for x in 'a b' c; do echo $x; done", "a b\nc\n", OK},
+		{"set x 'a b'; for y in $x; do echo $y; done", "a\nb\n", OK},
+		{"for x in; do echo $x; done", "", OK},
+		{"for x in a b; do fail; done", "", FAIL},
+		{"set x 0; c() { return $x; }; while c; do echo a; set x 1; done", "a\n", OK},
+		{"while fail; do echo a; done", "", OK},
+		{"f() { echo $1 $#; }; f a b", "a 2\n", OK},
+		{"function f { for x in $@; do echo $x; done; }; f a b", "a\nb\n", OK},
+		{"f() { echo $#; }; f 'a  b' c", "2\n", OK},
+		{"f() { fail; }; f || echo a", "a\n", OK},
+		{"f() { f; }; f", "", FAIL},
+	}
+
+	for _, tt := range tests {
+		sh, out, _ := newTestShell(t)
+
+		stat, _ := sh.Exec(tt.line)
+		if stat != tt.stat || out.String() != tt.out {
+			t.Errorf("%s: got %s with output %q, want %s with output %q", tt.line, stat, out.String(), tt.stat, tt.out)
+		}
+	}
+}
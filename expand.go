@@ -0,0 +1,115 @@
+package gshell
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type wordPartKind int
+
+const (
+	partLiteral      wordPartKind = iota
+	partVariable                  // $NAME, ${NAME} or ${NAME:-fallback}
+	partSubstitution              // $(command)
+)
+
+// word is a single shell word made of literal text and expansions. The
+// expansions are only resolved right before the command runs, so a variable
+// set earlier on the same line is visible to the commands after it.
+type word struct {
+	parts  []wordPart
+	quoted bool // a quoted word is kept even if it expands to nothing
+}
+
+type wordPart struct {
+	kind     wordPartKind
+	text     string // literal text or variable name
+	fallback *word
+	list     *commandList // command line of a substitution
+}
+
+func (w *word) appendLiteral(r rune) {
+	if n := len(w.parts); n > 0 && w.parts[n-1].kind == partLiteral {
+		w.parts[n-1].text += string(r)
+		return
+	}
+	w.parts = append(w.parts, wordPart{kind: partLiteral, text: string(r)})
+}
+
+// expandWord resolves the expansions of a word, ok is false for an unquoted
+// word that expanded to nothing as such a word is dropped from the command.
+// With nounset set, expanding a variable that is not set is an error.
+func (sh *Shell) expandWord(w word) (value string, ok bool, err error) {
+	var sb strings.Builder
+
+	for _, part := range w.parts {
+		switch part.kind {
+		case partLiteral:
+			sb.WriteString(part.text)
+		case partVariable:
+			value, set := sh.GetVar(part.text)
+			if value == "" && part.fallback != nil {
+				value, _, err = sh.expandWord(*part.fallback)
+				if err != nil {
+					return "", false, err
+				}
+			} else if !set && sh.scope.opts.nounset.Load() {
+				return "", false, fmt.Errorf("%s: unbound variable", part.text)
+			}
+			sb.WriteString(value)
+		case partSubstitution:
+			output, _, _ := sh.capture(part.list)
+			sb.WriteString(strings.TrimSpace(output))
+		}
+	}
+
+	return sb.String(), w.quoted || sb.Len() > 0, nil
+}
+
+// expandWords expands each word to a single field, except for a word made of
+// $@ alone which expands to one field per positional parameter.
+func (sh *Shell) expandWords(words []word) ([]string, error) {
+	var fields []string
+	for _, w := range words {
+		if isParamsWord(w) {
+			fields = append(fields, sh.params()...)
+			continue
+		}
+
+		value, ok, err := sh.expandWord(w)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			fields = append(fields, value)
+		}
+	}
+	return fields, nil
+}
+
+// isParamsWord tells if the word is $@ alone, quoted or not, which expands
+// to one field per positional parameter.
+func isParamsWord(w word) bool {
+	return len(w.parts) == 1 && w.parts[0].kind == partVariable && w.parts[0].text == "@"
+}
+
+// Capture runs a command line and returns what its commands wrote to the
+// output stream instead of writing it, errors are still written to the
+// error stream of the shell.
+func (sh *Shell) Capture(line string) (string, Status, error) {
+	list, err := sh.parseInput(&line)
+	if err != nil {
+		return "", FAIL, err
+	}
+
+	return sh.capture(list)
+}
+
+func (sh *Shell) capture(list *commandList) (string, Status, error) {
+	var buf bytes.Buffer
+	view := sh.withStreams(sh.inStream, &syncWriter{w: &buf}, sh.errStream)
+
+	stat, err := view.runList(list)
+	return buf.String(), stat, err
+}
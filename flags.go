@@ -0,0 +1,256 @@
+package gshell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FlagType string
+
+const (
+	FLAG_BOOL     FlagType = "bool"
+	FLAG_STRING   FlagType = "string"
+	FLAG_INT      FlagType = "int"
+	FLAG_DURATION FlagType = "duration"
+	FLAG_SLICE    FlagType = "slice" // Repeatable, each occurrence may hold comma separated values
+)
+
+type Flag struct {
+	Name        string // Long name, used as --name
+	Short       string // Optional one letter name, used as -n
+	Description string
+	Type        FlagType
+	Default     string
+	Required    bool
+	// Complete computes the completions of the value of the flag, prior are
+	// the positional args typed before it
+	Complete func(sh *Shell, prefix string, prior []string) []string
+}
+
+func NewFlag(
+	name string,
+	short string,
+	description string,
+	flagType FlagType,
+	defaultValue string,
+	required bool,
+) *Flag {
+	return &Flag{
+		Name:        name,
+		Short:       short,
+		Description: description,
+		Type:        flagType,
+		Default:     defaultValue,
+		Required:    required,
+	}
+}
+
+// FlagValues holds the flags parsed for a command invocation, accessors
+// return the zero value for unknown flags.
+type FlagValues struct {
+	values map[string]any
+	set    map[string]bool
+}
+
+func (fv *FlagValues) Bool(name string) bool {
+	v, _ := fv.get(name).(bool)
+	return v
+}
+
+func (fv *FlagValues) String(name string) string {
+	v, _ := fv.get(name).(string)
+	return v
+}
+
+func (fv *FlagValues) Int(name string) int {
+	v, _ := fv.get(name).(int)
+	return v
+}
+
+func (fv *FlagValues) Duration(name string) time.Duration {
+	v, _ := fv.get(name).(time.Duration)
+	return v
+}
+
+func (fv *FlagValues) Strings(name string) []string {
+	v, _ := fv.get(name).([]string)
+	return v
+}
+
+// IsSet reports whether the flag was given on the command line rather than
+// taken from its default.
+func (fv *FlagValues) IsSet(name string) bool {
+	return fv != nil && fv.set[name]
+}
+
+func (fv *FlagValues) get(name string) any {
+	if fv == nil {
+		return nil
+	}
+	return fv.values[name]
+}
+
+// Flags returns the flags parsed for the running command.
+func (sh *Shell) Flags() *FlagValues {
+	if sh.flags == nil {
+		return &FlagValues{}
+	}
+	return sh.flags
+}
+
+// parseFlags extracts the flags from args and returns the positional args left.
+// Flags may appear anywhere before a `--`, as --name=value, --name value,
+// -n value, -nvalue or grouped boolean short flags like -abc. A `-` alone or
+// followed by a digit is a positional argument.
+func parseFlags(flags []Flag, args []string) (*FlagValues, []string, error) {
+	fv := &FlagValues{values: make(map[string]any), set: make(map[string]bool)}
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--":
+			positional = append(positional, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			flag := findFlag(flags, name)
+			if flag == nil {
+				return nil, nil, fmt.Errorf("unknown flag --%s", name)
+			}
+
+			if !hasValue && flag.Type != FLAG_BOOL {
+				if i+1 >= len(args) {
+					return nil, nil, fmt.Errorf("flag --%s requires a value", name)
+				}
+				i++
+				value = args[i]
+			}
+
+			if err := fv.add(flag, value, hasValue); err != nil {
+				return nil, nil, err
+			}
+			fv.set[flag.Name] = true
+		case len(arg) > 1 && arg[0] == '-' && !isDigit(rune(arg[1])):
+			consumed, err := fv.addShort(flags, arg[1:], args[i+1:])
+			if err != nil {
+				return nil, nil, err
+			}
+			i += consumed
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	for i := range flags {
+		flag := &flags[i]
+		if fv.set[flag.Name] {
+			continue
+		}
+
+		if flag.Required {
+			return nil, nil, fmt.Errorf("missing required flag --%s", flag.Name)
+		}
+
+		if err := fv.add(flag, flag.Default, true); err != nil {
+			return nil, nil, fmt.Errorf("invalid default: %s", err)
+		}
+	}
+
+	return fv, positional, nil
+}
+
+// addShort parses a group of short flags, where only the last one may take a
+// value, either attached (-n5) or from the next arg (-n 5). It returns the
+// number of next args consumed.
+func (fv *FlagValues) addShort(flags []Flag, group string, next []string) (int, error) {
+	for j, short := range group {
+		flag := findFlag(flags, string(short))
+		if flag == nil {
+			return 0, fmt.Errorf("unknown flag -%c", short)
+		}
+		fv.set[flag.Name] = true
+
+		if flag.Type == FLAG_BOOL {
+			if err := fv.add(flag, "", false); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if rest := group[j+1:]; rest != "" {
+			return 0, fv.add(flag, rest, true)
+		}
+
+		if len(next) == 0 {
+			return 0, fmt.Errorf("flag -%c requires a value", short)
+		}
+		return 1, fv.add(flag, next[0], true)
+	}
+
+	return 0, nil
+}
+
+// add converts and stores a flag value, a boolean flag given without value
+// is true and an empty value stands for the zero value of the flag type.
+func (fv *FlagValues) add(flag *Flag, value string, hasValue bool) error {
+	var err error
+
+	switch flag.Type {
+	case FLAG_BOOL:
+		b := !hasValue
+		if value != "" {
+			b, err = strconv.ParseBool(value)
+		}
+		fv.values[flag.Name] = b
+	case FLAG_INT:
+		n := 0
+		if value != "" {
+			n, err = strconv.Atoi(value)
+		}
+		fv.values[flag.Name] = n
+	case FLAG_DURATION:
+		var d time.Duration
+		if value != "" {
+			d, err = time.ParseDuration(value)
+		}
+		fv.values[flag.Name] = d
+	case FLAG_SLICE:
+		values, _ := fv.values[flag.Name].([]string)
+		if value != "" {
+			values = append(values, strings.Split(value, ",")...)
+		}
+		fv.values[flag.Name] = values
+	default:
+		fv.values[flag.Name] = value
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid value %q for flag --%s, expected %s", value, flag.Name, flag.Type)
+	}
+	return nil
+}
+
+func findFlag(flags []Flag, name string) *Flag {
+	for i := range flags {
+		if flags[i].Name == name || (flags[i].Short != "" && flags[i].Short == name) {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// usage returns the flag as shown in help, like `--count, -c <int>`.
+func (flag *Flag) usage() string {
+	usage := "--" + flag.Name
+	if flag.Short != "" {
+		usage += ", -" + flag.Short
+	}
+	if flag.Type != FLAG_BOOL {
+		usage += " <" + string(flag.Type) + ">"
+	}
+	return usage
+}
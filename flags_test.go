@@ -0,0 +1,97 @@
+package gshell
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var testFlags = []Flag{
+	{Name: "all", Short: "a", Type: FLAG_BOOL},
+	{Name: "brief", Short: "b", Type: FLAG_BOOL},
+	{Name: "count", Short: "n", Type: FLAG_INT, Default: "1"},
+	{Name: "name", Type: FLAG_STRING},
+	{Name: "timeout", Short: "t", Type: FLAG_DURATION, Default: "1s"},
+	{Name: "tag", Type: FLAG_SLICE},
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		all, brief bool
+		count      int
+		name       string
+		timeout    time.Duration
+		tags       []string
+	}{
+		{nil, nil, false, false, 1, "", time.Second, nil},
+		{[]string{"x", "y"}, []string{"x", "y"}, false, false, 1, "", time.Second, nil},
+		{[]string{"--all", "x"}, []string{"x"}, true, false, 1, "", time.Second, nil},
+		{[]string{"-ab"}, nil, true, true, 1, "", time.Second, nil},
+		{[]string{"-abn", "5", "x"}, []string{"x"}, true, true, 5, "", time.Second, nil},
+		{[]string{"-n5"}, nil, false, false, 5, "", time.Second, nil},
+		{[]string{"-an5"}, nil, true, false, 5, "", time.Second, nil},
+		{[]string{"--count=7", "--name", "bob"}, nil, false, false, 7, "bob", time.Second, nil},
+		{[]string{"--name="}, nil, false, false, 1, "", time.Second, nil},
+		{[]string{"-t", "2m"}, nil, false, false, 1, "", 2 * time.Minute, nil},
+		{[]string{"--tag", "a,b", "--tag=c"}, nil, false, false, 1, "", time.Second, []string{"a", "b", "c"}},
+		{[]string{"x", "--", "-a", "--count"}, []string{"x", "-a", "--count"}, false, false, 1, "", time.Second, nil},
+		{[]string{"-5"}, []string{"-5"}, false, false, 1, "", time.Second, nil},
+		{[]string{"-"}, []string{"-"}, false, false, 1, "", time.Second, nil},
+	}
+
+	for _, tt := range tests {
+		fv, positional, err := parseFlags(testFlags, tt.args)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+
+		if !slices.Equal(positional, tt.positional) ||
+			fv.Bool("all") != tt.all || fv.Bool("brief") != tt.brief ||
+			fv.Int("count") != tt.count || fv.String("name") != tt.name ||
+			fv.Duration("timeout") != tt.timeout || !slices.Equal(fv.Strings("tag"), tt.tags) {
+			t.Errorf("%q: got positional %q, all %v, brief %v, count %d, name %q, timeout %s, tags %q",
+				tt.args, positional, fv.Bool("all"), fv.Bool("brief"), fv.Int("count"),
+				fv.String("name"), fv.Duration("timeout"), fv.Strings("tag"))
+		}
+	}
+}
+
+func TestParseFlagsIsSet(t *testing.T) {
+	fv, _, err := parseFlags(testFlags, []string{"-n", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fv.IsSet("count") || fv.IsSet("timeout") {
+		t.Errorf("got count set %v and timeout set %v, want true and false", fv.IsSet("count"), fv.IsSet("timeout"))
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	required := append(slices.Clone(testFlags), Flag{Name: "env", Type: FLAG_STRING, Required: true})
+
+	tests := []struct {
+		flags []Flag
+		args  []string
+		err   string
+	}{
+		{testFlags, []string{"--nope"}, "unknown flag --nope"},
+		{testFlags, []string{"-az"}, "unknown flag -z"},
+		{testFlags, []string{"--count"}, "flag --count requires a value"},
+		{testFlags, []string{"-an"}, "flag -n requires a value"},
+		{testFlags, []string{"--count", "x"}, `invalid value "x" for flag --count, expected int`},
+		{testFlags, []string{"--all=maybe"}, `invalid value "maybe" for flag --all, expected bool`},
+		{required, nil, "missing required flag --env"},
+		{required, []string{"--", "--env", "prod"}, "missing required flag --env"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := parseFlags(tt.flags, tt.args)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: got error %v, want %q", tt.args, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package gshell
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// functions holds the functions defined with `name() { ... }`, shared by every
+// view of a shell.
+type functions struct {
+	mu    sync.RWMutex
+	funcs map[string]*funcDef
+}
+
+func newFunctions() *functions {
+	return &functions{funcs: make(map[string]*funcDef)}
+}
+
+// clone copies the functions, for a script running in a child scope.
+func (f *functions) clone() *functions {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return &functions{funcs: maps.Clone(f.funcs)}
+}
+
+// frame is the scope of a running function or script: its positional
+// parameters and whether it returned.
+type frame struct {
+	params   []string
+	depth    int
+	returned atomic.Bool
+}
+
+// maxCallDepth stops runaway recursion before it exhausts the stack.
+const maxCallDepth = 1000
+
+// defineFunction makes the function callable like a command, replacing any
+// function with the same name. Functions take precedence over commands.
+func (sh *Shell) defineFunction(fn *funcDef) {
+	sh.funcs.mu.Lock()
+	defer sh.funcs.mu.Unlock()
+
+	sh.funcs.funcs[fn.name] = fn
+}
+
+func (sh *Shell) function(name string) (*funcDef, bool) {
+	sh.funcs.mu.RLock()
+	defer sh.funcs.mu.RUnlock()
+
+	fn, ok := sh.funcs.funcs[name]
+	return fn, ok
+}
+
+// withFrame returns a view of the shell running a function or script with the
+// given positional parameters.
+func (sh *Shell) withFrame(params []string) *Shell {
+	view := *sh
+	view.frame = &frame{params: params}
+	if sh.frame != nil {
+		view.frame.depth = sh.frame.depth + 1
+	}
+	return &view
+}
+
+func (sh *Shell) callFunction(fn *funcDef, args []string) (Status, error) {
+	view := sh.withFrame(args)
+	if view.frame.depth >= maxCallDepth {
+		err := fmt.Errorf("%s: maximum function nesting level exceeded (%d)", fn.name, maxCallDepth)
+		sh.Error(SHELL_PREFIX, err.Error())
+		sh.logger.Error(SHELL_PREFIX, err.Error())
+		return FAIL, err
+	}
+
+	return view.runList(fn.body)
+}
+
+// returnError carries the exit code given to `return`, so that $? reports it
+// while the status of the function is only OK or FAIL.
+type returnError struct {
+	code int
+}
+
+func (e *returnError) Error() string {
+	return fmt.Sprintf("returned %d", e.code)
+}
+
+// returnFromFrame stops the running function or script with the given exit
+// code, any code but 0 being a failure, or with the status of the last
+// command.
+func (sh *Shell) returnFromFrame(args []string) (Status, error) {
+	var err error
+	switch {
+	case sh.frame == nil:
+		err = fmt.Errorf("return: can only be used in a function or script")
+	case len(args) > 1:
+		err = fmt.Errorf("return: too many arguments")
+	}
+
+	stat, lastErr := sh.last.get()
+	if err == nil && len(args) == 1 {
+		code, convErr := strconv.Atoi(args[0])
+		switch {
+		case convErr != nil:
+			err = fmt.Errorf("return: numeric argument required: %s", args[0])
+		case code == 0:
+			stat, lastErr = OK, nil
+		default:
+			stat, lastErr = FAIL, &returnError{code: code}
+		}
+	}
+
+	if err != nil {
+		sh.Error(SHELL_PREFIX, err.Error())
+		sh.logger.Error(SHELL_PREFIX, err.Error())
+		return FAIL, err
+	}
+
+	sh.frame.returned.Store(true)
+	return stat, lastErr
+}
+
+// returning tells if `return` was called in the running function or script,
+// or if the script was aborted by errexit, so that the commands after it are
+// skipped.
+func (sh *Shell) returning() bool {
+	return (sh.frame != nil && sh.frame.returned.Load()) || sh.scope.aborted.Load()
+}
+
+// params returns the positional parameters of the running function or script.
+func (sh *Shell) params() []string {
+	if sh.frame == nil {
+		return nil
+	}
+	return sh.frame.params
+}
+
+// param returns the value of a positional or special parameter, ok is false
+// for a positional parameter that was not passed.
+func (sh *Shell) param(name string) (value string, ok bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(sh.last.exitCode()), true
+	case "#":
+		return strconv.Itoa(len(sh.params())), true
+	case "@":
+		return strings.Join(sh.params(), " "), true
+	}
+
+	n, err := strconv.Atoi(name)
+	if err != nil {
+		return "", false
+	}
+
+	if params := sh.params(); n >= 1 && n <= len(params) {
+		return params[n-1], true
+	}
+	return "", false
+}
+
+func isParamName(name string) bool {
+	if len(name) == 1 && isSpecialParam(rune(name[0])) {
+		return true
+	}
+
+	for _, r := range name {
+		if !isDigit(r) {
+			return false
+		}
+	}
+	return name != ""
+}
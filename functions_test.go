@@ -0,0 +1,37 @@
+package gshell
+
+import "testing"
+
+func TestReturn(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+		stat Status
+	}{
+		{"f() { echo a; return; echo b; }; f", "a\n", OK},
+		{"f() { fail; return; }; f || echo $?", "1\n", OK},
+		{"f() { return 0; }; f && echo $?", "0\n", OK},
+		{"f() { return 2; }; f; echo $?", "2\n", OK},
+		{"f() { return 2; }; f || echo $?", "2\n", OK},
+		{"f() { return 2; }; g() { f; }; g; echo $?", "2\n", OK},
+		{"f() { return 2; }; g() { f; return; }; g; echo $?", "2\n", OK},
+		{"f() { return 130; }; f; echo $?", "130\n", OK},
+		{"f() { return 124; }; f", "", FAIL},
+		{"f() { return 127; }; f", "", FAIL},
+		{"f() { for x in a b; do echo $x; return 3; done; }; f; echo $?", "a\n3\n", OK},
+		{"f() { while echo a; do return; done; }; f", "a\n", OK},
+		{"f() { if echo a; then return 1; fi; echo b; }; f", "a\n", FAIL},
+		{"return", "", FAIL},
+		{"f() { return a; }; f", "", FAIL},
+		{"f() { return 1 2; }; f", "", FAIL},
+	}
+
+	for _, tt := range tests {
+		sh, out, _ := newTestShell(t)
+
+		stat, _ := sh.Exec(tt.line)
+		if stat != tt.stat || out.String() != tt.out {
+			t.Errorf("%s: got %s with output %q, want %s with output %q", tt.line, stat, out.String(), tt.stat, tt.out)
+		}
+	}
+}
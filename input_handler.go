@@ -10,13 +10,13 @@ type InputHandler struct {
 	reader      *readline.Instance
 	prompt      string
 	historyFile string
-	listener    *KeyListener
+	completer   readline.AutoCompleter
 }
 
 func NewInputHandler(
 	prompt,
 	historyFile string,
-	listener *KeyListener,
+	completer readline.AutoCompleter,
 	stdin io.ReadCloser,
 	stdout io.Writer,
 	stderr io.Writer,
@@ -27,7 +27,7 @@ func NewInputHandler(
 		InterruptPrompt:   "^C",
 		EOFPrompt:         "exit",
 		HistorySearchFold: true,
-		Listener:          listener,
+		AutoComplete:      completer,
 		Stdin:             stdin,
 		Stdout:            stdout,
 		Stderr:            stderr,
@@ -42,7 +42,7 @@ func NewInputHandler(
 		reader:      rl,
 		prompt:      prompt,
 		historyFile: historyFile,
-		listener:    listener,
+		completer:   completer,
 	}, nil
 }
 
@@ -0,0 +1,100 @@
+package gshell
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+)
+
+// Invocation describes a single run of a command, it is passed to Command.Run
+// with the args already validated and converted to the Type of their Argument.
+// Accessors are keyed by Argument.Name and return the zero value for an
+// argument that was not given or has another type.
+type Invocation struct {
+	Shell   *Shell
+	Command *Command
+	Args    []string
+	values  map[string]any
+}
+
+// Has reports whether the argument was given or filled from its default.
+func (inv *Invocation) Has(name string) bool {
+	_, ok := inv.values[name]
+	return ok
+}
+
+func (inv *Invocation) String(name string) string {
+	v, _ := inv.value(name).(string)
+	return v
+}
+
+func (inv *Invocation) Int(name string) int {
+	v, _ := inv.value(name).(int)
+	return v
+}
+
+func (inv *Invocation) Float(name string) float64 {
+	v, _ := inv.value(name).(float64)
+	return v
+}
+
+func (inv *Invocation) Bool(name string) bool {
+	v, _ := inv.value(name).(bool)
+	return v
+}
+
+func (inv *Invocation) Duration(name string) time.Duration {
+	v, _ := inv.value(name).(time.Duration)
+	return v
+}
+
+// Path returns a path argument with a leading ~ expanded to the home directory.
+func (inv *Invocation) Path(name string) string {
+	path := inv.String(name)
+	if path == "" {
+		return ""
+	}
+	return filepath.Clean(expandHome(path))
+}
+
+// Strings returns every value of a variadic argument, or the single value of
+// any other argument.
+func (inv *Invocation) Strings(name string) []string {
+	var values []string
+	for _, v := range inv.all(name) {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// Context is cancelled when the command is interrupted.
+func (inv *Invocation) Context() context.Context {
+	return inv.Shell.Context()
+}
+
+// Flags returns the flags parsed for the command.
+func (inv *Invocation) Flags() *FlagValues {
+	return inv.Shell.Flags()
+}
+
+// value returns the value of an argument, the first one for a variadic argument.
+func (inv *Invocation) value(name string) any {
+	if all := inv.all(name); len(all) > 0 {
+		return all[0]
+	}
+	return nil
+}
+
+func (inv *Invocation) all(name string) []any {
+	v, ok := inv.values[name]
+	if !ok {
+		return nil
+	}
+
+	if all, ok := v.([]any); ok {
+		return all
+	}
+	return []any{v}
+}
@@ -0,0 +1,238 @@
+package gshell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// job is a command line started with a trailing &. Its output is buffered
+// until it is brought to the foreground with `fg`, or until it is reported
+// done at the prompt, so that it never writes over the prompt.
+type job struct {
+	id      int
+	line    string
+	started time.Time
+	ended   time.Time
+	status  Status // Only set once done is closed
+	done    chan struct{}
+	cancel  context.CancelFunc
+	out     *jobOutput
+	err     *jobOutput
+}
+
+// state describes the job for `jobs` and completion notices.
+func (j *job) state() string {
+	select {
+	case <-j.done:
+	default:
+		return "Running"
+	}
+
+	if j.status == OK {
+		return "Done"
+	}
+	return string(j.status)
+}
+
+func (j *job) elapsed() time.Duration {
+	end := time.Now()
+	select {
+	case <-j.done:
+		end = j.ended
+	default:
+	}
+	return end.Sub(j.started).Round(100 * time.Millisecond)
+}
+
+// maxJobOutput is how many bytes of output a job keeps while it is in the
+// background, so that a job writing forever does not exhaust the memory.
+const maxJobOutput = 1 << 20
+
+// jobOutput buffers the output of a job while it is in the background, and
+// writes through to the attached writer while it is in the foreground. Only
+// the last maxJobOutput bytes are buffered.
+type jobOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	w   io.Writer
+}
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.w != nil {
+		return o.w.Write(p)
+	}
+
+	n, err := o.buf.Write(p)
+	if extra := o.buf.Len() - maxJobOutput; extra > 0 {
+		o.buf.Next(extra)
+	}
+	return n, err
+}
+
+// attach flushes the buffered output to w and writes to it from now on, a nil
+// w detaches the output again.
+func (o *jobOutput) attach(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if w != nil {
+		_, _ = o.buf.WriteTo(w)
+	}
+	o.w = w
+}
+
+// jobTable holds the background jobs of a shell, ordered by id. It is shared
+// by every view of the shell.
+type jobTable struct {
+	mu   sync.Mutex
+	jobs []*job
+}
+
+func newJobTable() *jobTable {
+	return &jobTable{}
+}
+
+// add numbers the job after the last one, so ids start at 1 again once every
+// job was collected.
+func (t *jobTable) add(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j.id = 1
+	if len(t.jobs) > 0 {
+		j.id = t.jobs[len(t.jobs)-1].id + 1
+	}
+	t.jobs = append(t.jobs, j)
+}
+
+// get returns the job with the given id, or the last started job for id 0.
+func (t *jobTable) get(id int) (*job, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if id == 0 {
+		if len(t.jobs) == 0 {
+			return nil, fmt.Errorf("no current job")
+		}
+		return t.jobs[len(t.jobs)-1], nil
+	}
+
+	for _, j := range t.jobs {
+		if j.id == id {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("no such job: %d", id)
+}
+
+func (t *jobTable) remove(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, other := range t.jobs {
+		if other == j {
+			t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *jobTable) list() []*job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]*job(nil), t.jobs...)
+}
+
+func (t *jobTable) finish(j *job, stat Status) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j.status = stat
+	j.ended = time.Now()
+	close(j.done)
+}
+
+// startJob runs the and-or list in its own goroutine, with no input and its
+// output buffered. The job keeps running when the command line that started
+// it is interrupted, it is only cancelled by `kill` or when the shell exits.
+func (sh *Shell) startJob(andOr *andOrList) *job {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(sh.Context()))
+	j := &job{
+		line:    andOr.text,
+		started: time.Now(),
+		done:    make(chan struct{}),
+		cancel:  cancel,
+		out:     &jobOutput{},
+		err:     &jobOutput{},
+	}
+	sh.jobs.add(j)
+
+	view := sh.withStreams(io.NopCloser(strings.NewReader("")), j.out, j.err).withContext(ctx)
+	view.last = newLastStatus()
+	view.scope = sh.scope.clone()
+	go func() {
+		defer cancel()
+
+		stat, _ := view.runAndOr(andOr)
+		if stat == EXIT {
+			stat = OK
+		}
+		sh.jobs.finish(j, stat)
+		sh.logger.Info(SHELL_PREFIX, fmt.Sprintf("Job %d (%s) finished with status %s", j.id, j.line, stat))
+	}()
+
+	sh.logger.Info(SHELL_PREFIX, fmt.Sprintf("Job %d (%s) started", j.id, j.line))
+	return j
+}
+
+// notifyJobs tells the user about the jobs that finished since the last
+// prompt, and shows their buffered output. Reported jobs are removed from the
+// job table.
+func (sh *Shell) notifyJobs() {
+	for _, j := range sh.jobs.list() {
+		select {
+		case <-j.done:
+		default:
+			continue
+		}
+
+		sh.Write(fmt.Sprintf("[%d] %-12s %s\n", j.id, j.state(), j.line))
+		sh.foreground(j)
+	}
+}
+
+// foreground writes the output of the job to the streams of the shell until
+// it is done, and removes it from the job table. Interrupting the shell
+// cancels the job.
+func (sh *Shell) foreground(j *job) Status {
+	j.out.attach(sh.outStream)
+	j.err.attach(sh.errStream)
+	defer j.out.attach(nil)
+	defer j.err.attach(nil)
+
+	select {
+	case <-j.done:
+	case <-sh.Context().Done():
+		j.cancel()
+		<-j.done
+	}
+
+	sh.jobs.remove(j)
+	return j.status
+}
+
+// stopJobs cancels every job still running.
+func (sh *Shell) stopJobs() {
+	for _, j := range sh.jobs.list() {
+		j.cancel()
+	}
+}
@@ -0,0 +1,100 @@
+package gshell
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobs(t *testing.T) {
+	sh, out, _ := newTestShell(t)
+
+	if stat, err := sh.Exec("echo a &"); stat != OK {
+		t.Fatalf("got %s (%v), want OK", stat, err)
+	}
+	if stat, err := sh.Exec("wait"); stat != OK {
+		t.Fatalf("wait: got %s (%v), want OK", stat, err)
+	}
+	if want := "[1] echo a\na\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+	if jobs := sh.jobs.list(); len(jobs) != 0 {
+		t.Errorf("got %d jobs after wait, want none", len(jobs))
+	}
+
+	// Ids start at 1 again once every job was collected
+	out.Reset()
+	sh.Exec("echo b & echo c &")
+	sh.Exec("wait 2; wait 1")
+	if want := "[1] echo b\n[2] echo c\nc\nb\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+}
+
+func TestJobsStatus(t *testing.T) {
+	sh, _, _ := newTestShell(t)
+	registerBlocking(sh, 0)
+
+	tests := []struct {
+		line string
+		stat Status
+	}{
+		{"fail & wait 1", FAIL},
+		{"echo a & wait 1", OK},
+		{"block & kill 1; wait 1", FAIL},
+		{"wait 1", FAIL},
+		{"fg", FAIL},
+		{"kill 1", FAIL},
+	}
+
+	for _, tt := range tests {
+		if stat, err := sh.Exec(tt.line); stat != tt.stat {
+			t.Errorf("%s: got %s (%v), want %s", tt.line, stat, err, tt.stat)
+		}
+	}
+}
+
+func TestNotifyJobs(t *testing.T) {
+	sh, out, errOut := newTestShell(t)
+
+	sh.Exec("both &")
+	j, err := sh.jobs.get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-j.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not finish")
+	}
+
+	// The job is reported once with its output, and then dropped
+	out.Reset()
+	sh.notifyJobs()
+	sh.notifyJobs()
+	if want := "[1] Done         both\nout\n"; out.String() != want {
+		t.Errorf("got output %q, want %q", out.String(), want)
+	}
+	if errOut.String() != "err\n" {
+		t.Errorf("got errors %q, want %q", errOut.String(), "err\n")
+	}
+	if jobs := sh.jobs.list(); len(jobs) != 0 {
+		t.Errorf("got %d jobs after the notice, want none", len(jobs))
+	}
+}
+
+func TestJobOutputLimit(t *testing.T) {
+	o := &jobOutput{}
+	chunk := strings.Repeat("a", 1000) + "\n"
+	for range 2 * maxJobOutput / len(chunk) {
+		_, _ = o.Write([]byte(chunk))
+	}
+	_, _ = o.Write([]byte("end\n"))
+
+	if n := o.buf.Len(); n != maxJobOutput {
+		t.Errorf("got %d bytes buffered, want %d", n, maxJobOutput)
+	}
+	if !strings.HasSuffix(o.buf.String(), "end\n") {
+		t.Errorf("the last output was not kept")
+	}
+}
@@ -0,0 +1,443 @@
+package gshell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// lexer splits a command line into words following POSIX shell quoting rules:
+//   - single quotes preserve every character literally,
+//   - double quotes preserve everything except a backslash followed by one of $ ` " \,
+//   - an unquoted backslash escapes the next character,
+//   - quotes may be mixed inside a single word (a"b c"'d' is one word),
+//   - empty quotes ("") produce an empty argument,
+//   - $NAME, ${NAME}, ${NAME:-default}, the parameters $1, $@, $# and $?,
+//     and $(command) are expanded outside single quotes,
+//   - a # at the start of a word comments out the rest of the line.
+//
+// Unquoted control operators (;, &, &&, ||, | and newlines) and redirection
+// operators (<, >, >>, 2>, 2>> and 2>&1) end the current word and are
+// emitted as separate tokens.
+type lexer struct {
+	input []rune
+	pos   int
+}
+
+func newLexer(input string) *lexer {
+	return &lexer{input: []rune(input)}
+}
+
+type tokenKind int
+
+const (
+	tokWord     tokenKind = iota
+	tokSemi               // ;
+	tokNewline            // \n
+	tokAmp                // &
+	tokAnd                // &&
+	tokOr                 // ||
+	tokPipe               // |
+	tokRedirect           // <, >, >>, 2>, 2>> or 2>&1
+	tokEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	word word // only set for tokWord
+	line int
+}
+
+// syntaxError is an error of the lexer or the parser, line is the line of the
+// input it was found on.
+type syntaxError struct {
+	line       int
+	msg        string
+	incomplete bool // The input ended too early, more lines may complete it
+}
+
+func (e *syntaxError) Error() string {
+	return e.msg
+}
+
+// isIncomplete tells if err is a syntax error caused by the input ending in
+// the middle of a command, like an unterminated quote or an if without fi.
+func isIncomplete(err error) bool {
+	var syntaxErr *syntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.incomplete
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokNewline:
+		return "newline"
+	}
+	return "`" + t.text + "`"
+}
+
+func (l *lexer) tokens() ([]token, error) {
+	var tokens []token
+	line, counted := 1, 0
+
+	for {
+		l.skipSpaces()
+
+		// Count the lines incrementally, newlines may also be inside words
+		for ; counted < l.pos; counted++ {
+			if l.input[counted] == '\n' {
+				line++
+			}
+		}
+
+		if l.eof() {
+			return append(tokens, token{kind: tokEOF, line: line}), nil
+		}
+
+		if l.peek() == '#' {
+			for !l.eof() && l.peek() != '\n' {
+				l.pos++
+			}
+			continue
+		}
+
+		if op, ok := l.readOperator(); ok {
+			op.line = line
+			tokens = append(tokens, op)
+			continue
+		}
+
+		start := l.pos
+		word, err := l.readWord()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token{kind: tokWord, text: string(l.input[start:l.pos]), word: word, line: line})
+	}
+}
+
+var redirectOperators = []string{"2>&1", "2>>", "2>", ">>", ">", "<"}
+
+func (l *lexer) readOperator() (token, bool) {
+	for _, op := range redirectOperators {
+		if l.hasPrefix(op) {
+			l.pos += len(op)
+			return token{kind: tokRedirect, text: op}, true
+		}
+	}
+
+	switch {
+	case l.hasPrefix("&&"):
+		l.pos += 2
+		return token{kind: tokAnd, text: "&&"}, true
+	case l.hasPrefix("&"):
+		l.pos++
+		return token{kind: tokAmp, text: "&"}, true
+	case l.hasPrefix("||"):
+		l.pos += 2
+		return token{kind: tokOr, text: "||"}, true
+	case l.hasPrefix("|"):
+		l.pos++
+		return token{kind: tokPipe, text: "|"}, true
+	case l.hasPrefix(";"):
+		l.pos++
+		return token{kind: tokSemi, text: ";"}, true
+	case l.hasPrefix("\n"):
+		l.pos++
+		return token{kind: tokNewline, text: "\n"}, true
+	}
+
+	return token{}, false
+}
+
+func (l *lexer) atOperator() bool {
+	return l.hasPrefix("&") || l.hasPrefix("|") || l.hasPrefix(";") ||
+		l.hasPrefix(">") || l.hasPrefix("<")
+}
+
+// readWord reads a word up to the next unquoted space or operator.
+func (l *lexer) readWord() (word, error) {
+	return l.readWordUntil(func() bool {
+		return unicode.IsSpace(l.peek()) || l.atOperator()
+	})
+}
+
+// readWordUntil reads word parts until the input ends or atEnd reports true
+// for the next unquoted character.
+func (l *lexer) readWordUntil(atEnd func() bool) (word, error) {
+	var w word
+
+	for !l.eof() && !atEnd() {
+		switch r := l.peek(); r {
+		case '\'':
+			if err := l.readSingleQuoted(&w); err != nil {
+				return word{}, err
+			}
+		case '"':
+			if err := l.readDoubleQuoted(&w); err != nil {
+				return word{}, err
+			}
+		case '\\':
+			l.pos++
+			if l.eof() {
+				return word{}, &syntaxError{line: l.lineAt(l.pos), msg: "trailing backslash at end of input", incomplete: true}
+			}
+			w.appendLiteral(l.next())
+		case '$':
+			if err := l.readDollar(&w); err != nil {
+				return word{}, err
+			}
+		default:
+			w.appendLiteral(l.next())
+		}
+	}
+
+	return w, nil
+}
+
+func (l *lexer) readSingleQuoted(w *word) error {
+	start := l.pos
+	l.pos++ // opening quote
+	w.quoted = true
+
+	for !l.eof() {
+		r := l.next()
+		if r == '\'' {
+			return nil
+		}
+		w.appendLiteral(r)
+	}
+
+	return l.unterminatedAt(start, "single quote")
+}
+
+func (l *lexer) readDoubleQuoted(w *word) error {
+	start := l.pos
+	l.pos++ // opening quote
+	w.quoted = true
+
+	for !l.eof() {
+		switch r := l.peek(); r {
+		case '"':
+			l.pos++
+			return nil
+		case '$':
+			if err := l.readDollar(w); err != nil {
+				return err
+			}
+		case '\\':
+			l.pos++
+			if !l.eof() && strings.ContainsRune("$`\"\\", l.peek()) {
+				r = l.next()
+			}
+			w.appendLiteral(r)
+		default:
+			w.appendLiteral(l.next())
+		}
+	}
+
+	return l.unterminatedAt(start, "double quote")
+}
+
+// readDollar reads a variable expansion ($NAME, ${NAME}, ${NAME:-default} or
+// a parameter like $1 or $?) or a command substitution starting at $. A $ that does not start an
+// expansion is kept literally.
+func (l *lexer) readDollar(w *word) error {
+	start := l.pos
+	l.pos++ // $
+
+	switch {
+	case l.eof():
+		w.appendLiteral('$')
+	case l.peek() == '{':
+		return l.readBraced(w, start)
+	case l.peek() == '(':
+		return l.readSubstitution(w, start)
+	case isNameStart(l.peek()):
+		w.parts = append(w.parts, wordPart{kind: partVariable, text: l.readName()})
+	case isDigit(l.peek()) || isSpecialParam(l.peek()):
+		w.parts = append(w.parts, wordPart{kind: partVariable, text: string(l.next())})
+	default:
+		w.appendLiteral('$')
+	}
+
+	return nil
+}
+
+func (l *lexer) readBraced(w *word, start int) error {
+	l.pos++ // {
+
+	part := wordPart{kind: partVariable, text: l.readName()}
+	if part.text == "" {
+		part.text = l.readParam()
+	}
+	if part.text == "" {
+		return l.errorAt(start, "bad substitution")
+	}
+
+	if l.hasPrefix(":-") {
+		l.pos += 2
+		fallback, err := l.readWordUntil(func() bool { return l.peek() == '}' })
+		if err != nil {
+			return err
+		}
+		part.fallback = &fallback
+	}
+
+	if l.eof() {
+		return l.unterminatedAt(start, "${")
+	}
+	if l.next() != '}' {
+		return l.errorAt(start, "bad substitution")
+	}
+
+	w.parts = append(w.parts, part)
+	return nil
+}
+
+// readSubstitution reads the command line of $(...) up to the matching
+// parenthesis, skipping quoted and escaped parentheses, and parses it.
+func (l *lexer) readSubstitution(w *word, start int) error {
+	l.pos++ // (
+	begin := l.pos
+	depth := 1
+
+	for !l.eof() {
+		switch l.next() {
+		case '\\':
+			l.skip(1)
+		case '\'':
+			l.skipUntil('\'')
+		case '"':
+			l.skipUntil('"')
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			list, err := parse(string(l.input[begin : l.pos-1]))
+			if err != nil {
+				return err
+			}
+			w.parts = append(w.parts, wordPart{kind: partSubstitution, list: list})
+			return nil
+		}
+	}
+
+	return l.unterminatedAt(start, "$(")
+}
+
+func (l *lexer) readName() string {
+	start := l.pos
+	for !l.eof() && (isNameStart(l.peek()) || (l.pos > start && isDigit(l.peek()))) {
+		l.pos++
+	}
+	return string(l.input[start:l.pos])
+}
+
+// errorAt returns a syntax error found at pos, with its column in its line.
+func (l *lexer) errorAt(pos int, msg string) error {
+	return &syntaxError{
+		line: l.lineAt(pos),
+		msg:  fmt.Sprintf("%s at column %d", msg, l.columnAt(pos)),
+	}
+}
+
+// unterminatedAt reports a construct starting at pos which is still open at
+// the end of input.
+func (l *lexer) unterminatedAt(pos int, what string) error {
+	return &syntaxError{
+		line:       l.lineAt(pos),
+		msg:        fmt.Sprintf("unterminated %s at column %d", what, l.columnAt(pos)),
+		incomplete: true,
+	}
+}
+
+func (l *lexer) lineAt(pos int) int {
+	line := 1
+	for _, r := range l.input[:pos] {
+		if r == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+func (l *lexer) columnAt(pos int) int {
+	lineStart := pos
+	for lineStart > 0 && l.input[lineStart-1] != '\n' {
+		lineStart--
+	}
+	return pos - lineStart + 1
+}
+
+// readParam reads the name of a positional parameter, which may have several
+// digits inside braces, or of a special parameter.
+func (l *lexer) readParam() string {
+	start := l.pos
+	switch {
+	case l.eof():
+	case isDigit(l.peek()):
+		for !l.eof() && isDigit(l.peek()) {
+			l.pos++
+		}
+	case isSpecialParam(l.peek()):
+		l.pos++
+	}
+	return string(l.input[start:l.pos])
+}
+
+// skipSpaces skips blanks, newlines are tokens.
+func (l *lexer) skipSpaces() {
+	for !l.eof() && unicode.IsSpace(l.peek()) && l.peek() != '\n' {
+		l.pos++
+	}
+}
+
+func (l *lexer) skip(n int) {
+	l.pos = min(l.pos+n, len(l.input))
+}
+
+// skipUntil moves past the next unescaped quote.
+func (l *lexer) skipUntil(quote rune) {
+	for !l.eof() {
+		r := l.next()
+		if r == quote {
+			return
+		}
+		if r == '\\' && quote != '\'' {
+			l.skip(1)
+		}
+	}
+}
+
+func (l *lexer) hasPrefix(prefix string) bool {
+	i := l.pos
+	for _, r := range prefix {
+		if i >= len(l.input) || l.input[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+func (l *lexer) eof() bool {
+	return l.pos >= len(l.input)
+}
+
+func (l *lexer) peek() rune {
+	return l.input[l.pos]
+}
+
+func (l *lexer) next() rune {
+	r := l.input[l.pos]
+	l.pos++
+	return r
+}
@@ -0,0 +1,95 @@
+package gshell
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// lexWords returns the words of input with their expansion, and the text of
+// the other tokens.
+func lexWords(t *testing.T, input string) []string {
+	t.Helper()
+
+	tokens, err := newLexer(input).tokens()
+	if err != nil {
+		t.Fatalf("tokens(%q): %v", input, err)
+	}
+
+	sh, _, _ := newTestShell(t)
+	var words []string
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokEOF:
+		case tokWord:
+			value, _, err := sh.expandWord(tok.word)
+			if err != nil {
+				t.Fatalf("expandWord(%q): %v", tok.text, err)
+			}
+			words = append(words, value)
+		default:
+			words = append(words, tok.text)
+		}
+	}
+	return words
+}
+
+func TestLexerQuoting(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{`echo a  b`, []string{"echo", "a", "b"}},
+		{`echo 'a  b'`, []string{"echo", "a  b"}},
+		{`echo "a  b"`, []string{"echo", "a  b"}},
+		{`echo a"b c"'d'`, []string{"echo", "ab cd"}},
+		{`echo "" ''`, []string{"echo", "", ""}},
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{`echo '\n' "\n" "\$x" "\\"`, []string{"echo", `\n`, `\n`, "$x", `\`}},
+		{`echo '$HOME' "it's"`, []string{"echo", "$HOME", "it's"}},
+		{`echo a;b&&c||d|e&f`, []string{"echo", "a", ";", "b", "&&", "c", "||", "d", "|", "e", "&", "f"}},
+		{`echo ';' "&&" \|`, []string{"echo", ";", "&&", "|"}},
+		{`cmd <in >out 2>&1 2>>log`, []string{"cmd", "<", "in", ">", "out", "2>&1", "2>>", "log"}},
+		{`echo a # comment`, []string{"echo", "a"}},
+		{`echo a#b`, []string{"echo", "a#b"}},
+	}
+
+	for _, tt := range tests {
+		if got := lexWords(t, tt.input); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input      string
+		msg        string
+		line       int
+		incomplete bool
+	}{
+		{`echo 'abc`, "unterminated single quote at column 6", 1, true},
+		{`echo a"bc`, "unterminated double quote at column 7", 1, true},
+		{`echo "a\"`, "unterminated double quote at column 6", 1, true},
+		{`echo ${x`, "unterminated ${ at column 6", 1, true},
+		{`echo $(ls`, "unterminated $( at column 6", 1, true},
+		{`echo ${}`, "bad substitution at column 6", 1, false},
+		{`echo ${x!}`, "bad substitution at column 6", 1, false},
+		{`echo a\`, "trailing backslash at end of input", 1, true},
+		{"echo a\n  echo 'b", "unterminated single quote at column 8", 2, true},
+	}
+
+	for _, tt := range tests {
+		_, err := newLexer(tt.input).tokens()
+
+		var syntaxErr *syntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%s: got error %v, want a syntax error", tt.input, err)
+			continue
+		}
+		if syntaxErr.msg != tt.msg || syntaxErr.line != tt.line || syntaxErr.incomplete != tt.incomplete {
+			t.Errorf("%s: got %q at line %d (incomplete %v), want %q at line %d (incomplete %v)",
+				tt.input, syntaxErr.msg, syntaxErr.line, syntaxErr.incomplete, tt.msg, tt.line, tt.incomplete)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package gshell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The command line grammar, a script is parsed the same way with newlines
+// separating its commands:
+//
+//	list     := and_or ( ( ";" | "&" | NEWLINE ) and_or )* [ ";" | "&" ]
+//	and_or   := pipeline ( ( "&&" | "||" ) pipeline )*
+//	pipeline := command ( "|" command )*
+//	command  := simple | if | for | while | function
+//	simple   := ( WORD | redirect )+
+//	redirect := ( "<" | ">" | ">>" | "2>" | "2>>" ) WORD | "2>&1"
+//	if       := "if" list "then" list ( "elif" list "then" list )* [ "else" list ] "fi"
+//	for      := "for" NAME [ "in" WORD* ] ( ";" | NEWLINE ) "do" list "done"
+//	while    := "while" list "do" list "done"
+//	function := ( "function" NAME [ "()" ] | NAME "()" ) "{" list "}"
+//
+// Reserved words are only recognized unquoted at the start of a command.
+type commandList struct {
+	items []*andOrList
+}
+
+// andOrList is a chain of pipelines joined by && and ||, ops[i] joins
+// pipelines[i] and pipelines[i+1]. A chain followed by & runs as a background
+// job, text is its source used to describe the job and line the line it
+// starts on.
+type andOrList struct {
+	pipelines  []*pipeline
+	ops        []tokenKind
+	background bool
+	text       string
+	line       int
+}
+
+// pipeline connects the output of each command to the input of the next one.
+type pipeline struct {
+	commands []commandNode
+}
+
+// commandNode is a command of a pipeline, one of *simpleCommand, *ifClause,
+// *forClause, *whileClause or *funcDef.
+type commandNode interface{}
+
+type simpleCommand struct {
+	words     []word
+	redirects []redirect
+}
+
+// ifClause runs bodies[i] for the first conds[i] that succeeds, or elseBody
+// if none does.
+type ifClause struct {
+	conds    []*commandList
+	bodies   []*commandList
+	elseBody *commandList
+}
+
+// forClause runs body once for each word with the variable name set to it,
+// or for each positional parameter when there is no `in`.
+type forClause struct {
+	name   string
+	words  []word
+	params bool
+	body   *commandList
+}
+
+type whileClause struct {
+	cond *commandList
+	body *commandList
+}
+
+type funcDef struct {
+	name string
+	body *commandList
+}
+
+// redirect replaces one of the standard streams of a command, target is the
+// file path and is empty for 2>&1.
+type redirect struct {
+	op     string
+	target word
+}
+
+// reservedWords can not start a simple command.
+var reservedWords = []string{"then", "elif", "else", "fi", "do", "done", "{", "}"}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(input string) (*commandList, error) {
+	tokens, err := newLexer(input).tokens()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	return p.parseList()
+}
+
+// parseList parses and-or lists until the end of input or one of the given
+// reserved words, which is left for the caller.
+func (p *parser) parseList(terminators ...string) (*commandList, error) {
+	list := &commandList{}
+
+	p.skipNewlines()
+	for p.peek().kind != tokEOF && !p.atReserved(terminators...) {
+		start := p.pos
+		item, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		item.text = p.source(start)
+		item.line = p.tokens[start].line
+		list.items = append(list.items, item)
+
+		switch p.peek().kind {
+		case tokSemi, tokNewline:
+			p.next()
+		case tokAmp:
+			p.next()
+			item.background = true
+		case tokEOF:
+		default:
+			if !p.atReserved(terminators...) {
+				return nil, p.unexpected()
+			}
+		}
+		p.skipNewlines()
+	}
+
+	return list, nil
+}
+
+// parseBody parses the list of a compound command, which may not be empty.
+func (p *parser) parseBody(terminators ...string) (*commandList, error) {
+	list, err := p.parseList(terminators...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list.items) == 0 {
+		return nil, p.unexpected()
+	}
+	return list, nil
+}
+
+func (p *parser) parseAndOr() (*andOrList, error) {
+	pl, err := p.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	andOr := &andOrList{pipelines: []*pipeline{pl}}
+	for p.peek().kind == tokAnd || p.peek().kind == tokOr {
+		op := p.next().kind
+		p.skipNewlines()
+
+		pl, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+
+		andOr.ops = append(andOr.ops, op)
+		andOr.pipelines = append(andOr.pipelines, pl)
+	}
+
+	return andOr, nil
+}
+
+func (p *parser) parsePipeline() (*pipeline, error) {
+	cmd, err := p.parseCommand()
+	if err != nil {
+		return nil, err
+	}
+
+	pl := &pipeline{commands: []commandNode{cmd}}
+	for p.peek().kind == tokPipe {
+		p.next()
+		p.skipNewlines()
+
+		cmd, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pl.commands = append(pl.commands, cmd)
+	}
+
+	return pl, nil
+}
+
+func (p *parser) parseCommand() (commandNode, error) {
+	switch {
+	case p.atReserved("if"):
+		return p.parseIf()
+	case p.atReserved("for"):
+		return p.parseFor()
+	case p.atReserved("while"):
+		return p.parseWhile()
+	case p.atReserved("function"):
+		return p.parseFunction()
+	case p.atReserved(reservedWords...):
+		return nil, p.unexpected()
+	}
+
+	if name, ok := p.funcName(); ok {
+		p.next()
+		if p.peek().text == "()" {
+			p.next()
+		}
+		return p.parseFuncBody(name)
+	}
+
+	return p.parseSimple()
+}
+
+func (p *parser) parseSimple() (*simpleCommand, error) {
+	cmd := &simpleCommand{}
+
+	for {
+		switch p.peek().kind {
+		case tokWord:
+			cmd.words = append(cmd.words, p.next().word)
+		case tokRedirect:
+			r, err := p.parseRedirect()
+			if err != nil {
+				return nil, err
+			}
+			cmd.redirects = append(cmd.redirects, r)
+		default:
+			if len(cmd.words) == 0 {
+				return nil, p.unexpected()
+			}
+			return cmd, nil
+		}
+	}
+}
+
+func (p *parser) parseRedirect() (redirect, error) {
+	op := p.next().text
+	if op == "2>&1" {
+		return redirect{op: op}, nil
+	}
+
+	if p.peek().kind != tokWord {
+		return redirect{}, p.unexpected()
+	}
+
+	return redirect{op: op, target: p.next().word}, nil
+}
+
+func (p *parser) parseIf() (*ifClause, error) {
+	clause := &ifClause{}
+
+	for p.atReserved("if", "elif") {
+		p.next()
+
+		cond, err := p.parseBody("then")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+
+		body, err := p.parseBody("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+
+		clause.conds = append(clause.conds, cond)
+		clause.bodies = append(clause.bodies, body)
+	}
+
+	if p.atReserved("else") {
+		p.next()
+
+		body, err := p.parseBody("fi")
+		if err != nil {
+			return nil, err
+		}
+		clause.elseBody = body
+	}
+
+	return clause, p.expect("fi")
+}
+
+func (p *parser) parseFor() (*forClause, error) {
+	p.next() // for
+
+	if p.peek().kind != tokWord || !isValidVarName(p.peek().text) {
+		return nil, p.unexpected()
+	}
+	clause := &forClause{name: p.next().text, params: true}
+
+	if p.atReserved("in") {
+		p.next()
+		clause.params = false
+
+		for p.peek().kind == tokWord {
+			clause.words = append(clause.words, p.next().word)
+		}
+	}
+
+	switch p.peek().kind {
+	case tokSemi, tokNewline:
+		p.next()
+	default:
+		if !clause.params {
+			return nil, p.unexpected()
+		}
+	}
+	p.skipNewlines()
+
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBody("done")
+	if err != nil {
+		return nil, err
+	}
+	clause.body = body
+
+	return clause, p.expect("done")
+}
+
+func (p *parser) parseWhile() (*whileClause, error) {
+	p.next() // while
+
+	cond, err := p.parseBody("do")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBody("done")
+	if err != nil {
+		return nil, err
+	}
+
+	return &whileClause{cond: cond, body: body}, p.expect("done")
+}
+
+func (p *parser) parseFunction() (*funcDef, error) {
+	p.next() // function
+
+	name, ok := p.funcName()
+	if !ok {
+		if p.peek().kind != tokWord || !isValidVarName(p.peek().text) {
+			return nil, p.unexpected()
+		}
+		name = p.peek().text
+	}
+	p.next()
+
+	if p.peek().text == "()" {
+		p.next()
+	}
+	return p.parseFuncBody(name)
+}
+
+func (p *parser) parseFuncBody(name string) (*funcDef, error) {
+	p.skipNewlines()
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseBody("}")
+	if err != nil {
+		return nil, err
+	}
+
+	return &funcDef{name: name, body: body}, p.expect("}")
+}
+
+// funcName tells if the next tokens start a function definition, either
+// `name()` or `name ()`, and returns the name.
+func (p *parser) funcName() (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokWord {
+		return "", false
+	}
+
+	if name, ok := strings.CutSuffix(tok.text, "()"); ok && isValidVarName(name) {
+		return name, true
+	}
+
+	if isValidVarName(tok.text) && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "()" {
+		return tok.text, true
+	}
+	return "", false
+}
+
+// atReserved tells if the next token is one of the given reserved words.
+func (p *parser) atReserved(words ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokWord {
+		return false
+	}
+
+	for _, w := range words {
+		if tok.text == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(reserved string) error {
+	if !p.atReserved(reserved) {
+		return p.unexpected()
+	}
+
+	p.next()
+	return nil
+}
+
+func (p *parser) skipNewlines() {
+	for p.peek().kind == tokNewline {
+		p.next()
+	}
+}
+
+// source joins the text of the tokens read since start on a single line.
+func (p *parser) source(start int) string {
+	var words []string
+	for _, tok := range p.tokens[start:p.pos] {
+		if tok.kind == tokNewline {
+			words = append(words, ";")
+			continue
+		}
+		words = append(words, tok.text)
+	}
+	return strings.Join(words, " ")
+}
+
+func (p *parser) unexpected() error {
+	return &syntaxError{
+		line:       p.peek().line,
+		msg:        fmt.Sprintf("syntax error near unexpected %s", p.peek()),
+		incomplete: p.peek().kind == tokEOF,
+	}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
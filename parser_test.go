@@ -0,0 +1,65 @@
+package gshell
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		items int
+	}{
+		{"", 0},
+		{"echo a; echo b &", 2},
+		{"echo a &&\n echo b", 1},
+		{"if fail; then echo a; elif echo b; then echo c; else echo d; fi", 1},
+		{"for x in a b; do echo $x; done", 1},
+		{"for x\ndo\n echo $x\ndone", 1},
+		{"while fail; do echo a; done", 1},
+		{"f() { echo a; }; function g { f; }", 2},
+		{"# comment only", 0},
+	}
+
+	for _, tt := range tests {
+		list, err := parse(tt.input)
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if len(list.items) != tt.items {
+			t.Errorf("%q: got %d items, want %d", tt.input, len(list.items), tt.items)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input      string
+		msg        string
+		incomplete bool
+	}{
+		{"echo a &&", "syntax error near unexpected end of input", true},
+		{"echo a |", "syntax error near unexpected end of input", true},
+		{"if echo a; then echo b", "syntax error near unexpected end of input", true},
+		{"for x in a b; do echo $x", "syntax error near unexpected end of input", true},
+		{"f() {", "syntax error near unexpected end of input", true},
+		{"; echo a", "syntax error near unexpected `;`", false},
+		{"echo a && || echo b", "syntax error near unexpected `||`", false},
+		{"if echo a; then fi", "syntax error near unexpected `fi`", false},
+		{"echo >", "syntax error near unexpected end of input", true},
+	}
+
+	for _, tt := range tests {
+		_, err := parse(tt.input)
+
+		var syntaxErr *syntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("%q: got error %v, want a syntax error", tt.input, err)
+			continue
+		}
+		if syntaxErr.msg != tt.msg || syntaxErr.incomplete != tt.incomplete {
+			t.Errorf("%q: got %q (incomplete %v), want %q (incomplete %v)", tt.input, syntaxErr.msg, syntaxErr.incomplete, tt.msg, tt.incomplete)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package gshell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+)
+
+// scope is the state of a running script shared by the functions it calls,
+// or of the prompt for commands typed by the user. A sourced file shares the
+// options and the aborted state of the script sourcing it.
+type scope struct {
+	path    string // Path of the script, empty at the prompt
+	opts    *options
+	aborted *atomic.Bool // A command failed with errexit set
+}
+
+// options are changed with `set -e`, `set -x` and `set -u`.
+type options struct {
+	errexit atomic.Bool
+	xtrace  atomic.Bool
+	nounset atomic.Bool
+}
+
+func newScope(path string) *scope {
+	return &scope{path: path, opts: &options{}, aborted: &atomic.Bool{}}
+}
+
+// clone copies the options of the scope, for a background job which must not
+// abort the script that started it.
+func (sc *scope) clone() *scope {
+	c := newScope(sc.path)
+	c.opts.errexit.Store(sc.opts.errexit.Load())
+	c.opts.xtrace.Store(sc.opts.xtrace.Load())
+	c.opts.nounset.Store(sc.opts.nounset.Load())
+	return c
+}
+
+// withPath returns the scope of a file sourced from this scope.
+func (sc *scope) withPath(path string) *scope {
+	return &scope{path: path, opts: sc.opts, aborted: sc.aborted}
+}
+
+// isOptionArg tells if the argument of `set` is a list of options.
+func isOptionArg(arg string) bool {
+	return strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+")
+}
+
+// set applies options like -e, +x or -eu, a - enables them and a +
+// disables them.
+func (opts *options) set(arg string) error {
+	if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+		return fmt.Errorf("invalid option: %s", arg)
+	}
+
+	enable := arg[0] == '-'
+	for _, option := range arg[1:] {
+		switch option {
+		case 'e':
+			opts.errexit.Store(enable)
+		case 'x':
+			opts.xtrace.Store(enable)
+		case 'u':
+			opts.nounset.Store(enable)
+		default:
+			return fmt.Errorf("invalid option: %c", option)
+		}
+	}
+
+	return nil
+}
+
+// runScript runs a script file with args as its positional parameters, in a
+// child scope: `return` and `exit` end the script and not the shell, and the
+// variables, functions, aliases and options it sets do not outlive it.
+func (sh *Shell) runScript(path string, args []string) (Status, error) {
+	list, err := parseScript(path)
+	if err != nil {
+		return FAIL, err
+	}
+
+	view := sh.withFrame(args)
+	view.scope = newScope(path)
+	view.vars = sh.vars.clone()
+	view.funcs = sh.funcs.clone()
+	view.aliases = sh.aliases.clone()
+
+	stat, _ := view.runList(list)
+	switch stat {
+	case OK, EXIT:
+		return OK, nil
+	case INTERRUPTED, TIMEOUT:
+		return stat, nil
+	}
+	return FAIL, &reportedError{fmt.Errorf("script %s finished with status %s", path, stat)}
+}
+
+// sourceFile runs a file in the current scope, so that the variables,
+// functions, aliases and options it sets stay once it returns. The positional
+// parameters are replaced by args if any are given. `exit` in the file exits
+// the shell.
+func (sh *Shell) sourceFile(path string, args []string) (Status, error) {
+	list, err := parseScript(path)
+	if err != nil {
+		return FAIL, err
+	}
+
+	if len(args) == 0 {
+		args = sh.params()
+	}
+	view := sh.withFrame(args)
+	view.scope = sh.scope.withPath(path)
+
+	stat, _ := view.runList(list)
+	switch stat {
+	case OK, EXIT, INTERRUPTED, TIMEOUT:
+		return stat, nil
+	}
+	return FAIL, &reportedError{fmt.Errorf("file %s finished with status %s", path, stat)}
+}
+
+// parseScript reads and parses a script, syntax errors are prefixed with the
+// path and line they were found at.
+func parseScript(path string) (*commandList, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading script file: %s", err)
+	}
+
+	list, err := parse(string(file))
+	if err != nil {
+		var syntaxErr *syntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("%s:%d: %s", path, syntaxErr.line, syntaxErr.msg)
+		}
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return list, nil
+}
+
+// reportedError is the error of a script whose failure was already reported
+// by checkFailure, it is not reported again with the usage of `run` or
+// `source`.
+type reportedError struct {
+	err error
+}
+
+func (e *reportedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reportedError) Unwrap() error {
+	return e.err
+}
+
+// isReported tells if the failure of a command was already reported.
+func isReported(err error) bool {
+	var reported *reportedError
+	return errors.As(err, &reported)
+}
+
+// checkFailure reports a failed and-or list of a script with its line, and
+// aborts the script if errexit is set. Failures in conditions are expected
+// and ignored, as are failures of a pipeline followed by && or ||. Once the
+// script is aborted, the failure is not reported again by its callers.
+func (sh *Shell) checkFailure(andOr *andOrList, last bool, stat Status, err error) {
+	if sh.condition || !last || sh.scope.aborted.Load() || (stat != FAIL && stat != NOT_FOUND && stat != TIMEOUT) {
+		return
+	}
+
+	if sh.scope.path != "" {
+		errMsg := fmt.Sprintf("%s:%d: command failed", sh.scope.path, andOr.line)
+		if err != nil {
+			errMsg += ": " + err.Error()
+		}
+		sh.Error(SHELL_PREFIX, errMsg)
+		sh.logger.Error(SHELL_PREFIX, errMsg)
+	}
+
+	if sh.scope.opts.errexit.Load() {
+		sh.scope.aborted.Store(true)
+	}
+}
+
+// asCondition returns a view of the shell running the condition of an if or
+// a while, whose failures are not reported.
+func (sh *Shell) asCondition() *Shell {
+	view := *sh
+	view.condition = true
+	return &view
+}
+
+// trace writes the expanded command to the error stream when xtrace is set.
+func (sh *Shell) trace(words []string) {
+	if !sh.scope.opts.xtrace.Load() {
+		return
+	}
+
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = quoteArg(w)
+	}
+	_, _ = sh.errStream.Write([]byte("+ " + strings.Join(quoted, " ") + "\n"))
+}
+
+// runRCFile sources the rc file, if it exists, so that the aliases, variables
+// and functions it defines are available at the prompt.
+func (sh *Shell) runRCFile() Status {
+	if sh.noRC {
+		return OK
+	}
+
+	path := expandHome(sh.rcFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return OK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	stat, err := sh.withContext(ctx).sourceFile(path, nil)
+	if err != nil {
+		if !isReported(err) {
+			sh.Error(SHELL_PREFIX, "Error running rc file, "+err.Error())
+		}
+		sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Error running rc file %s: %s", path, err))
+	}
+	return stat
+}
@@ -0,0 +1,166 @@
+package gshell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetOptions(t *testing.T) {
+	tests := []struct {
+		line   string
+		out    string
+		errOut string // Contained in the error stream
+		stat   Status
+	}{
+		{"fail; echo a", "a\n", "", OK},
+		{"set -e; fail; echo a", "", "", FAIL},
+		{"set -e; fail || echo a; echo b", "a\nb\n", "", OK},
+		{"set -e; fail && echo a; echo b", "b\n", "", OK},
+		{"set -e; if fail; then echo a; fi; echo b", "b\n", "", OK},
+		{"set -e; set +e; fail; echo a", "a\n", "", OK},
+		{"set -x; echo a 'b c'", "a b c\n", "+ echo a 'b c'\n", OK},
+		{"set -x; set +x; echo a", "a\n", "+ set +x\n", OK},
+		{"echo a$nope", "a\n", "", OK},
+		{"set -u; echo a$nope", "", "nope: unbound variable", FAIL},
+		{"set -u; echo ${nope:-a}", "a\n", "", OK},
+		{"set -eu; echo $nope; echo a", "", "nope: unbound variable", FAIL},
+		{"set -q", "", "invalid option: q", FAIL},
+		{"set +", "", "invalid option: +", FAIL},
+	}
+
+	for _, tt := range tests {
+		sh, out, errOut := newTestShell(t)
+
+		stat, _ := sh.Exec(tt.line)
+		if stat != tt.stat || out.String() != tt.out {
+			t.Errorf("%s: got %s with output %q, want %s with output %q", tt.line, stat, out.String(), tt.stat, tt.out)
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) {
+			t.Errorf("%s: got errors %q, want %q", tt.line, errOut.String(), tt.errOut)
+		}
+	}
+}
+
+// writeScript writes a script in a temporary directory and returns its
+// quoted path.
+func writeScript(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return quoteArg(path)
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		script string
+		line   string // Run with {} replaced by the path of the script
+		out    string
+		stat   Status
+	}{
+		{"echo $1 $#", "run {} a b", "a 2\n", OK},
+		{"set x a\nf() { echo f; }", "set x b; run {}; echo $x; f", "b\n", NOT_FOUND},
+		{"echo a\nexit\necho b", "run {}; echo c", "a\nc\n", OK},
+		{"echo a\nreturn 3\necho b", "run {}; echo c", "a\nc\n", OK},
+		{"fail\necho a", "run {}", "a\n", OK},
+		{"echo a\nfail", "run {} || echo b", "a\nb\n", OK},
+		{"set -e\nfail\necho a", "run {}; echo b", "b\n", OK},
+		{"set x a\nf() { echo f; }", "source {}; echo $x; f", "a\nf\n", OK},
+		{"echo $1", "f() { source {}; }; f a", "a\n", OK},
+		{"echo $1", "f() { . {} b; }; f a", "b\n", OK},
+		{"echo a\nfail", "source {} || echo b", "a\nb\n", OK},
+	}
+
+	for _, tt := range tests {
+		sh, out, _ := newTestShell(t)
+		path := writeScript(t, "s.shell", tt.script)
+
+		line := strings.ReplaceAll(tt.line, "{}", path)
+		stat, _ := sh.Exec(line)
+		if stat != tt.stat || out.String() != tt.out {
+			t.Errorf("%s: got %s with output %q, want %s with output %q", tt.line, stat, out.String(), tt.stat, tt.out)
+		}
+	}
+}
+
+// TestRunScriptErrors checks that the failure of a script is reported once,
+// with the line it failed at, and without the usage of `run`.
+func TestRunScriptErrors(t *testing.T) {
+	for _, name := range []string{"run", "source"} {
+		sh, _, errOut := newTestShell(t)
+		path := writeScript(t, "s.shell", "echo a\nfail\n")
+
+		stat, err := sh.Exec(name + " " + path)
+		if stat != FAIL || err == nil {
+			t.Errorf("%s: got %s (%v), want FAIL with an error", name, stat, err)
+		}
+		if strings.Count(errOut.String(), "command failed") != 1 ||
+			!strings.Contains(errOut.String(), "s.shell:2: command failed: failed") ||
+			strings.Contains(errOut.String(), "Usage: "+name) {
+			t.Errorf("%s: got errors %q", name, errOut.String())
+		}
+	}
+
+	sh, _, errOut := newTestShell(t)
+	path := writeScript(t, "s.shell", "echo a\nif echo b\n")
+	if stat, _ := sh.Exec("run " + path); stat != FAIL || !strings.Contains(errOut.String(), "s.shell:3: syntax error") {
+		t.Errorf("got %s with errors %q, want FAIL with a syntax error", stat, errOut.String())
+	}
+}
+
+func TestRCFile(t *testing.T) {
+	tests := []struct {
+		rc     string
+		stat   Status
+		out    string // Output of `hi; f; echo $x` after the rc file
+		errOut string // Contained in the error stream
+	}{
+		{"set x a\nf() { echo f; }\nalias hi 'echo hi'", OK, "hi\nf\na\n", ""},
+		{"set -x", OK, "", "+ hi"},
+		{"exit\nset x a", EXIT, "", ""},
+		{"fail\nset x a", OK, "a\n", "rc:1: command failed: failed"},
+		{"if echo a", FAIL, "", "Error running rc file"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "rc")
+		if err := os.WriteFile(path, []byte(tt.rc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sh, out, errOut := newTestShell(t, WithRCFile(path))
+
+		if stat := sh.runRCFile(); stat != tt.stat {
+			t.Errorf("%q: got %s, want %s", tt.rc, stat, tt.stat)
+		}
+		out.Reset()
+		sh.Exec("hi; f; echo $x")
+		if tt.out != "" && out.String() != tt.out {
+			t.Errorf("%q: got output %q, want %q", tt.rc, out.String(), tt.out)
+		}
+		if !strings.Contains(errOut.String(), tt.errOut) || strings.Count(errOut.String(), "failed: failed") > 1 {
+			t.Errorf("%q: got errors %q, want %q", tt.rc, errOut.String(), tt.errOut)
+		}
+	}
+}
+
+func TestRCFileSkipped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rc")
+	if err := os.WriteFile(path, []byte("echo rc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sh, out, _ := newTestShell(t, WithRCFile(path))
+	sh.noRC = true
+	if stat := sh.runRCFile(); stat != OK || out.Len() != 0 {
+		t.Errorf("got %s with output %q, want OK without output", stat, out.String())
+	}
+
+	sh, out, errOut := newTestShell(t, WithRCFile(filepath.Join(t.TempDir(), "missing")))
+	if stat := sh.runRCFile(); stat != OK || out.Len() != 0 || errOut.Len() != 0 {
+		t.Errorf("got %s with output %q and errors %q, want OK", stat, out.String(), errOut.String())
+	}
+}
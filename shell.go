@@ -1,14 +1,18 @@
 package gshell
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
 )
@@ -16,12 +20,31 @@ import (
 type Status string
 
 const (
-	OK        Status = "OK"
-	FAIL      Status = "FAIL"
-	EXIT      Status = "EXIT"
-	NOT_FOUND Status = "NOT_FOUND"
+	OK          Status = "OK"
+	FAIL        Status = "FAIL"
+	EXIT        Status = "EXIT"
+	NOT_FOUND   Status = "NOT_FOUND"
+	INTERRUPTED Status = "INTERRUPTED" // The context of the command was cancelled, by Ctrl+C for instance
+	TIMEOUT     Status = "TIMEOUT"     // The command ran longer than its timeout
 )
 
+// ExitCode maps the status to a process exit code, following the
+// conventions of POSIX shells.
+func (s Status) ExitCode() int {
+	switch s {
+	case OK, EXIT:
+		return 0
+	case TIMEOUT:
+		return 124
+	case NOT_FOUND:
+		return 127
+	case INTERRUPTED:
+		return 130
+	default:
+		return 1
+	}
+}
+
 const (
 	SHELL_PROMPT   = ">>> "
 	SHELL_PREFIX   = "SHELL"
@@ -41,6 +64,17 @@ const (
 type Shell struct {
 	commands          map[string]*Command
 	rootCommand       map[string]string
+	vars              *variables
+	jobs              *jobTable
+	last              *lastStatus
+	funcs             *functions
+	frame             *frame // Positional parameters of the running function or script
+	scope             *scope // Options of the running script
+	condition         bool   // Running the condition of an if or a while
+	aliases           *aliases
+	expanding         []string        // Aliases being expanded
+	flags             *FlagValues     // Flags of the running command
+	ctx               context.Context // Context of the running command line
 	earlyExecCommands []EarlyCommand
 	inStream          io.ReadCloser
 	outStream         io.Writer
@@ -50,6 +84,11 @@ type Shell struct {
 	historyFile       string
 	logger            *Logger
 	exitFunc          func()
+	commandTimeout    time.Duration
+	failFast          bool
+	rcFile            string
+	noRC              bool
+	aliasFile         string
 }
 
 type Option func(*Shell)
@@ -103,10 +142,45 @@ func WithExitFunc(exitFunc func()) Option {
 	}
 }
 
+// Default to no timeout, a command with its own Timeout overrides it
+func WithCommandTimeout(timeout time.Duration) Option {
+	return func(sh *Shell) {
+		sh.commandTimeout = timeout
+	}
+}
+
+// Default to false, batch mode stops at the first line that does not succeed
+// when true. Also enabled by passing --fail-fast to the program.
+func WithFailFast(failFast bool) Option {
+	return func(sh *Shell) {
+		sh.failFast = failFast
+	}
+}
+
+// Default to ~/.gshellrc, sourced before the prompt of the interactive shell.
+// Passing --norc to the program skips it.
+func WithRCFile(rcFile string) Option {
+	return func(sh *Shell) {
+		sh.rcFile = rcFile
+	}
+}
+
+// Default to ~/.gshell_aliases, aliases are loaded from it and saved to it
+func WithAliasFile(aliasFile string) Option {
+	return func(sh *Shell) {
+		sh.aliasFile = aliasFile
+	}
+}
+
 func New(options ...Option) *Shell {
 	sh := &Shell{
 		commands:    make(map[string]*Command),
 		rootCommand: make(map[string]string),
+		vars:        newVariables(),
+		jobs:        newJobTable(),
+		last:        newLastStatus(),
+		funcs:       newFunctions(),
+		scope:       newScope(""),
 	}
 
 	for _, option := range options {
@@ -128,24 +202,22 @@ func New(options ...Option) *Shell {
 	if sh.historyFile == "" {
 		sh.historyFile = "~/.gshell_history"
 	}
+	if sh.rcFile == "" {
+		sh.rcFile = "~/.gshellrc"
+	}
+	if sh.aliasFile == "" {
+		sh.aliasFile = "~/.gshell_aliases"
+	}
+
 	if sh.logger == nil {
 		sh.logger = NewLogger("gshell.log")
 	}
 
-	listener := &KeyListener{shell: sh}
-	inputHandler, err := NewInputHandler(
-		sh.prompt,
-		sh.historyFile,
-		listener,
-		sh.inStream,
-		sh.outStream,
-		sh.errStream,
-	)
-
+	aliases, err := loadAliases(expandHome(sh.aliasFile))
 	if err != nil {
-		panic(err)
+		sh.logger.Warn(SHELL_PREFIX, "Error loading aliases: "+err.Error())
 	}
-	sh.inputHandler = inputHandler
+	sh.aliases = aliases
 
 	sh.registerBuiltInCommands()
 	return sh
@@ -156,6 +228,7 @@ func (sh *Shell) RegisterCommand(cmd *Command) {
 		sh.addAlias(alias, cmd.Name)
 	}
 
+	cmd.linkSubcommands()
 	sh.commands[cmd.Name] = cmd
 }
 
@@ -168,17 +241,23 @@ func (sh *Shell) GetCommands() []*Command {
 	for _, cmd := range sh.commands {
 		cmds = append(cmds, cmd)
 	}
+
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
 	return cmds
 }
 
+// Error is written to the error stream of the running command
 func (sh *Shell) Error(prefix, err string) {
 	prefix = "[" + prefix + " Error]: " + err + "\n"
-	sh.WriteColored(COLOR_RED, prefix)
+	sh.writeColored(sh.errStream, COLOR_RED, prefix)
 }
 
+// Warn is written to the error stream of the running command
 func (sh *Shell) Warn(prefix, warning string) {
 	prefix = "[" + prefix + " Warning]: " + warning + "\n"
-	sh.WriteColored(COLOR_YELLOW, prefix)
+	sh.writeColored(sh.errStream, COLOR_YELLOW, prefix)
 }
 
 func (sh *Shell) Info(prefix, info string) {
@@ -192,24 +271,59 @@ func (sh *Shell) Success(prefix, success string) {
 }
 
 func (sh *Shell) WriteColored(color string, output string) {
-	if !isTerminal(sh.outStream) {
-		sh.Write(output)
-		return
-	}
-	sh.Write(string(color) + output + string(COLOR_RESET))
+	sh.writeColored(sh.outStream, color, output)
 }
 
 func (sh *Shell) Write(output string) {
 	_, _ = sh.outStream.Write([]byte(output))
 }
 
+// Stdin returns the input stream of the running command, inside a pipeline
+// this is the output of the previous command.
+func (sh *Shell) Stdin() io.Reader {
+	return sh.inStream
+}
+
+// Context returns the context of the running command, it is cancelled when
+// the user presses Ctrl+C. Long running handlers should return once it is done.
+func (sh *Shell) Context() context.Context {
+	if sh.ctx == nil {
+		return context.Background()
+	}
+	return sh.ctx
+}
+
+// Run sources the rc file and starts the interactive loop. When the program
+// was given a command it runs it once with RunArgs, and when the input is not
+// a terminal it runs every line of the input without prompting, both without
+// the rc file. In both cases the process then exits with the code of the
+// resulting status.
 func (sh *Shell) Run(welcMessage string) {
+	args := sh.parseShellOptions(os.Args[1:])
+	if len(args) > 0 || !sh.isInteractive() {
+		var code int
+		if len(args) > 0 {
+			code = sh.RunArgs(args)
+		} else {
+			code = sh.runBatch()
+		}
+
+		sh.Exit()
+		os.Exit(code)
+	}
+
+	sh.startInputHandler()
 	sh.clearScreen()
+	if sh.runRCFile() == EXIT {
+		sh.Exit()
+		return
+	}
 	sh.Write(welcMessage)
 	sh.sortEarlyCommands()
 
 	for {
 		sh.Write("\n")
+		sh.notifyJobs()
 		sh.executeEarlyCommands()
 
 		input, err := sh.inputHandler.ReadLine()
@@ -217,12 +331,21 @@ func (sh *Shell) Run(welcMessage string) {
 			if errors.Is(err, io.EOF) { // Ctrl+D to exit
 				break
 			}
+			if errors.Is(err, readline.ErrInterrupt) { // Ctrl+C at the prompt
+				continue
+			}
 
 			sh.Error(SHELL_PREFIX, "Error reading input: "+err.Error())
 			continue
 		}
 
-		if sh.execute(&input) == EXIT {
+		// Ctrl+C while the line runs cancels its context instead of
+		// killing the shell
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		stat, _ := sh.withContext(ctx).execute(&input)
+		stop()
+
+		if stat == EXIT {
 			break
 		}
 	}
@@ -230,9 +353,48 @@ func (sh *Shell) Run(welcMessage string) {
 	sh.Exit()
 }
 
+// RunArgs runs a single command without the interactive loop and returns
+// the process exit code of its status. args are either a command with its
+// arguments, taken as is, or -c followed by a command line to parse, like
+// `mytool user list` or `mytool -c "connect db && migrate"`.
+func (sh *Shell) RunArgs(args []string) int {
+	if len(args) == 0 {
+		return OK.ExitCode()
+	}
+
+	// Ctrl+C cancels the command instead of killing the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	view := sh.withContext(ctx)
+
+	if args[0] != "-c" {
+		stat, _ := view.runCommand(args[0], args[1:])
+		return stat.ExitCode()
+	}
+
+	if len(args) < 2 {
+		errMsg := "Option -c requires a command line"
+		sh.Error(SHELL_PREFIX, errMsg)
+		sh.logger.Error(SHELL_PREFIX, errMsg)
+		return FAIL.ExitCode()
+	}
+	stat, _ := view.execute(&args[1])
+	return stat.ExitCode()
+}
+
+// Exec runs a command line as if it was typed at the prompt and returns the
+// status and error of its last command, errors are also written to the error
+// stream of the shell.
+func (sh *Shell) Exec(line string) (Status, error) {
+	return sh.execute(&line)
+}
+
 func (sh *Shell) Exit() {
+	sh.stopJobs()
 	_ = sh.logger.Close()
-	sh.inputHandler.Close()
+	if sh.inputHandler != nil {
+		sh.inputHandler.Close()
+	}
 	sh.inStream.Close()
 
 	if sh.exitFunc != nil {
@@ -246,25 +408,115 @@ func (sh *Shell) Exit() {
 
 */
 
+// withContext returns a view of the shell running its commands under ctx.
+func (sh *Shell) withContext(ctx context.Context) *Shell {
+	view := *sh
+	view.ctx = ctx
+	return &view
+}
+
+// withStreams returns a view of the shell sharing its commands and state but
+// reading from and writing to the given streams, used to run a single command
+// invocation without touching the streams of the parent shell.
+func (sh *Shell) withStreams(in io.ReadCloser, out io.Writer, err io.Writer) *Shell {
+	view := *sh
+	view.inStream = in
+	view.outStream = out
+	view.errStream = err
+	return &view
+}
+
+func (sh *Shell) writeColored(w io.Writer, color string, output string) {
+	if isTerminal(w) {
+		output = color + output + COLOR_RESET
+	}
+	_, _ = w.Write([]byte(output))
+}
+
+func (sh *Shell) writeCommandHelp(cmd *Command) {
+	sh.WriteColored(COLOR_YELLOW, cmd.FullName()+": ")
+	sh.Write(cmd.Description + "\n")
+	sh.Write("    Aliases: ")
+	if len(cmd.Aliases) > 0 {
+		sh.Write(strings.Join(cmd.Aliases, ", ") + "\n")
+	} else {
+		sh.Write("No aliases found.\n")
+	}
+
+	if len(cmd.Subcommands) > 0 {
+		var names []string
+		for _, sub := range cmd.Subcommands {
+			names = append(names, sub.Name)
+		}
+		sh.Write("    Subcommands: " + strings.Join(names, ", ") + "\n")
+	}
+
+	if len(cmd.Args) > 0 {
+		sh.Write("    Arguments:\n")
+		for _, arg := range cmd.Args {
+			sh.Write(helpLine("<"+arg.Name+"> ("+string(arg.Type)+")", arg.Description, arg.Required, arg.Default))
+		}
+	}
+
+	if len(cmd.Flags) > 0 {
+		sh.Write("    Flags:\n")
+		for _, flag := range cmd.Flags {
+			sh.Write(helpLine(flag.usage(), flag.Description, flag.Required, flag.Default))
+		}
+	}
+	sh.WriteColored(COLOR_CYAN, "    Usage: "+cmd.Usage+"\n\n")
+}
+
+func helpLine(name, description string, required bool, defaultValue string) string {
+	line := "        " + name
+	if description != "" {
+		line += "  " + description
+	}
+
+	if required {
+		line += " (required)"
+	} else if defaultValue != "" {
+		line += " (default: " + defaultValue + ")"
+	}
+	return line + "\n"
+}
+
 func (sh *Shell) sortEarlyCommands() {
 	sort.SliceStable(sh.earlyExecCommands, func(i, j int) bool {
 		return sh.earlyExecCommands[i].Priority > sh.earlyExecCommands[j].Priority
 	})
 }
 
-func (sh *Shell) handleCommandOrAliasNotFound(cmd string) {
-	nearestCmd, matchedAlias := sh.getNearestCommandOrAlias(cmd)
+func (sh *Shell) handleCommandOrAliasNotFound(cmd string, args []string) {
+	candidates := sh.GetCommands()
+	prefix := ""
+
+	// The command exists but the subcommand is unknown or missing
+	if parent, rest, ok := sh.resolveCommand(cmd, args); ok {
+		if len(rest) == 0 {
+			errMsg := "Command (" + parent.FullName() + ") requires a subcommand, type `help " + parent.FullName() + "` for list of subcommands"
+			sh.Error(SHELL_PREFIX, errMsg)
+			sh.logger.Error(SHELL_PREFIX, errMsg)
+			return
+		}
+
+		candidates = parent.Subcommands
+		prefix = parent.FullName() + " "
+		cmd = rest[0]
+	}
+
+	nearestCmd, matchedAlias := sh.getNearestCommandOrAlias(cmd, candidates)
 	if len(cmd) > 20 {
 		cmd = cmd[:20] + "..."
 	}
 
-	errMsg := "Command (" + cmd + ") not found, "
+	errMsg := "Command (" + prefix + cmd + ") not found, "
 
 	if nearestCmd != "" {
 		if matchedAlias != "" {
-			errMsg += "did you mean `" + matchedAlias + "` (alias for `" + nearestCmd + "`)?, "
+			errMsg += "did you mean `" + prefix + matchedAlias + "` (alias for `" + prefix + nearestCmd + "`)?, "
 		} else {
-			errMsg += "did you mean `" + nearestCmd + "`?, "
+			errMsg += "did you mean `" + prefix + nearestCmd + "`?, "
 		}
 	}
 	errMsg += "type `help` for list of commands"
@@ -272,14 +524,18 @@ func (sh *Shell) handleCommandOrAliasNotFound(cmd string) {
 	sh.logger.Error(SHELL_PREFIX, errMsg)
 }
 
-func (sh *Shell) getNearestCommandOrAlias(cmd string) (string, string) {
+// getNearestCommandOrAlias returns the command, and the alias of it if that
+// is nearer, at an edit distance of at most 2 from cmd. A name must also be
+// nearer than its length, so that a short alias like `.` is not suggested for
+// every name of one or two characters.
+func (sh *Shell) getNearestCommandOrAlias(cmd string, candidates []*Command) (string, string) {
 	best := 2
 	nearestCmd := ""
 	matchedAlias := ""
 
-	for _, c := range sh.commands {
+	for _, c := range candidates {
 		dist := editDistance(c.Name, cmd)
-		if dist <= best {
+		if dist <= best && dist < len(c.Name) {
 			best = dist
 			nearestCmd = c.Name
 			matchedAlias = ""
@@ -287,7 +543,7 @@ func (sh *Shell) getNearestCommandOrAlias(cmd string) (string, string) {
 		// Also check aliases
 		for _, alias := range c.Aliases {
 			dist := editDistance(alias, cmd)
-			if dist <= best {
+			if dist <= best && dist < len(alias) {
 				best = dist
 				nearestCmd = c.Name
 				matchedAlias = alias
@@ -297,13 +553,8 @@ func (sh *Shell) getNearestCommandOrAlias(cmd string) (string, string) {
 	return nearestCmd, matchedAlias
 }
 
-func (sh *Shell) parseInput(input *string) (string, []string) {
-	tokens := strings.Fields(*input)
-	if len(tokens) == 0 {
-		return "", nil
-	}
-
-	return tokens[0], tokens[1:]
+func (sh *Shell) parseInput(input *string) (*commandList, error) {
+	return parse(*input)
 }
 
 func (sh *Shell) executeEarlyCommands() {
@@ -312,91 +563,290 @@ func (sh *Shell) executeEarlyCommands() {
 	}
 }
 
-func (sh *Shell) autoCompleteCommand(cmd string) (string, bool) {
-	for c := range sh.commands {
-		if strings.HasPrefix(c, cmd) {
-			return c, true
+func (sh *Shell) executeCommand(cmdOrAlias string, args []string) (Status, error) {
+	if strings.ToUpper(cmdOrAlias) == string(EXIT) {
+		return EXIT, nil
+	}
+
+	if cmdOrAlias == "" {
+		return OK, nil
+	}
+
+	if command, args, ok := sh.resolveCommand(cmdOrAlias, args); ok {
+		if command.Handler == nil && command.Run == nil {
+			return NOT_FOUND, fmt.Errorf("command %s requires a subcommand", command.FullName())
+		}
+
+		view := sh.withStreams(sh.inStream, sh.outStream, sh.errStream)
+		if len(command.Flags) > 0 {
+			flags, positional, err := parseFlags(command.Flags, args)
+			if err != nil {
+				sh.Error(COMMAND_PREFIX, "Invalid flags, "+err.Error())
+				sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Invalid flags for command %s: %s", cmdOrAlias, err))
+				return FAIL, fmt.Errorf("invalid flags: %w", err)
+			}
+			view.flags, args = flags, positional
+		}
+
+		validArgs, values, err := command.validateArgs(args)
+		if err != nil {
+			sh.Error(COMMAND_PREFIX, "Invalid arguments, "+err.Error())
+			sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Invalid arguments for command %s: %s", cmdOrAlias, err))
+			return FAIL, fmt.Errorf("invalid arguments: %w", err)
+		}
+
+		timeout := command.Timeout
+		if timeout == 0 {
+			timeout = sh.commandTimeout
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(view.Context(), timeout)
+			defer cancel()
+			view.ctx = ctx
+		}
+
+		stat, err := view.runHandler(command, &Invocation{Shell: view, Command: command, Args: validArgs, values: values})
+		switch stat {
+		case INTERRUPTED:
+			sh.logger.Info(SHELL_PREFIX, fmt.Sprintf("Command %s interrupted", cmdOrAlias))
+			return INTERRUPTED, view.Context().Err()
+		case TIMEOUT:
+			errMsg := fmt.Sprintf("Command %s timed out", cmdOrAlias)
+			if timeout > 0 {
+				errMsg += " after " + timeout.String()
+			}
+			sh.Error(COMMAND_PREFIX, errMsg)
+			sh.logger.Error(SHELL_PREFIX, errMsg)
+			return TIMEOUT, view.Context().Err()
+		}
+
+		if err != nil {
+			// A condition failing is expected, its error is only logged
+			if !sh.condition && !isReported(err) {
+				sh.Error(COMMAND_PREFIX, err.Error())
+			}
+			sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Error executing command %s: %s", cmdOrAlias, err.Error()))
+			return FAIL, err
 		}
+
+		return stat, nil
 	}
 
-	return "", false
+	sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Command %s not found\n", cmdOrAlias))
+	return NOT_FOUND, fmt.Errorf("command not found: %s", cmdOrAlias)
 }
 
-func (sh *Shell) autoCompleteArg(cmd, argPrefix string) (string, bool) {
-	if command, ok := sh.findCommandByNameOrAlias(cmd); ok {
-		for _, arg := range command.Args {
-			if arg.Tag != EMPTY_TAG {
-				if strings.HasPrefix(arg.Tag, argPrefix) {
-					return arg.Tag, true
-				}
-			}
+// interruptGracePeriod is how long an interrupted handler may take to return
+// before the shell stops waiting for it.
+const interruptGracePeriod = 500 * time.Millisecond
+
+// runHandler calls the handler of the command in its own goroutine, so that
+// the shell gets back to the prompt soon after the context is cancelled even
+// if the handler ignores it. Such a handler keeps running in the background
+// until it returns by itself.
+func (sh *Shell) runHandler(command *Command, inv *Invocation) (Status, error) {
+	ctx := sh.Context()
+	if ctx.Err() != nil {
+		return cancelledStatus(ctx), nil
+	}
+
+	type result struct {
+		stat Status
+		err  error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		var r result
+		if command.Run != nil {
+			r.stat, r.err = command.Run(inv)
+		} else {
+			r.stat, r.err = command.Handler(inv.Shell, inv.Args)
+		}
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if ctx.Err() != nil {
+			return cancelledStatus(ctx), nil
+		}
+		return r.stat, r.err
+	case <-ctx.Done():
+		// Give the handler a chance to clean up before going back
+		select {
+		case <-done:
+		case <-time.After(interruptGracePeriod):
 		}
+		return cancelledStatus(ctx), nil
 	}
+}
 
-	return "", false
+// cancelledStatus tells a command that ran out of time from an interrupted one.
+func cancelledStatus(ctx context.Context) Status {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return TIMEOUT
+	}
+	return INTERRUPTED
 }
 
-func (sh *Shell) executeCommand(cmdOrAlias string, args []string) Status {
-	if strings.ToUpper(cmdOrAlias) == string(EXIT) {
-		return EXIT
+// findCommandByNameOrAlias also accepts a path of subcommands, like `user add`
+func (sh *Shell) findCommandByNameOrAlias(cmdOrAlias string) (*Command, bool) {
+	path := strings.Fields(cmdOrAlias)
+	if len(path) == 0 {
+		return &Command{}, false
 	}
 
-	if cmdOrAlias == "" {
-		return OK
+	command, rest, ok := sh.resolveCommand(path[0], path[1:])
+	if !ok || len(rest) > 0 {
+		return &Command{}, false
 	}
+	return command, true
+}
 
-	if command, ok := sh.findCommandByNameOrAlias(cmdOrAlias); ok {
-		ok, err := command.ValidateArgs(args)
+// resolveCommand finds the command named by cmdOrAlias and the subcommands
+// named by the leading args, and returns the args left for the command.
+func (sh *Shell) resolveCommand(cmdOrAlias string, args []string) (*Command, []string, bool) {
+	command, ok := sh.commands[cmdOrAlias]
+	if !ok {
+		name, ok := sh.rootCommand[cmdOrAlias]
 		if !ok {
-			sh.Error(COMMAND_PREFIX, "Invalid arguments, "+err.Error())
-			sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Invalid arguments for command %s: %s", cmdOrAlias, err))
-			return FAIL
+			return &Command{}, args, false
 		}
+		command = sh.commands[name]
+	}
 
-		stat, err := command.Handler(sh, args)
+	command, args = command.resolveSubcommand(args)
+	return command, args, true
+}
 
-		if err != nil {
-			sh.Error(COMMAND_PREFIX, err.Error())
-			sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Error executing command %s: %s", cmdOrAlias, err.Error()))
-			return FAIL
-		}
+func (sh *Shell) execute(input *string) (Status, error) {
+	// A command failing with errexit set at the prompt only aborts its line
+	sh.scope.aborted.Store(false)
 
-		return stat
+	list, err := sh.parseInput(input)
+	if err != nil {
+		sh.Error(SHELL_PREFIX, "Parse error: "+err.Error())
+		sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Parse error in %q: %s", *input, err))
+		sh.last.set(FAIL, err)
+		return FAIL, err
+	}
+
+	return sh.runList(list)
+}
+
+// parseShellOptions applies the options given to the program before the
+// command, like --fail-fast or --norc, and returns the remaining arguments.
+func (sh *Shell) parseShellOptions(args []string) []string {
+	for len(args) > 0 {
+		switch args[0] {
+		case "--fail-fast":
+			sh.failFast = true
+		case "--norc":
+			sh.noRC = true
+		case "--":
+			return args[1:]
+		default:
+			return args
+		}
+		args = args[1:]
 	}
 
-	sh.logger.Error(SHELL_PREFIX, fmt.Sprintf("Command %s not found\n", cmdOrAlias))
-	return NOT_FOUND
+	return args
 }
 
-func (sh *Shell) findCommandByNameOrAlias(cmdOrAlias string) (*Command, bool) {
-	if command, ok := sh.commands[cmdOrAlias]; ok {
-		return command, true
+// isInteractive tells if the input stream is a terminal, streams other than
+// files are considered interactive.
+func (sh *Shell) isInteractive() bool {
+	if sh.inStream == readline.Stdin {
+		return isTerminal(os.Stdin)
 	}
-
-	if command, ok := sh.rootCommand[cmdOrAlias]; ok {
-		return sh.commands[command], true
+	if f, ok := sh.inStream.(*os.File); ok {
+		return isTerminal(f)
 	}
-	return &Command{}, false
+
+	return true
 }
 
-func (sh *Shell) execute(input *string) Status {
-	commandOrAlias, args := sh.parseInput(input)
+// runBatch executes the input stream line by line without readline, prompt,
+// welcome message or early commands, for input piped from a file or another
+// program. A command left incomplete at the end of a line, like an if without
+// its fi, is continued on the next lines. It returns the exit code of the last
+// command, or of the first command that failed with fail fast.
+func (sh *Shell) runBatch() int {
+	reader := bufio.NewReader(sh.inStream)
+	stat := OK
+
+	var command strings.Builder // Lines of the command being read
+	startLine := 0
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			sh.Error(SHELL_PREFIX, "Error reading input: "+err.Error())
+			sh.logger.Error(SHELL_PREFIX, "Error reading input: "+err.Error())
+			return FAIL.ExitCode()
+		}
+		eof := err != nil
 
-	switch sh.executeCommand(commandOrAlias, args) {
-	case EXIT:
-		return EXIT
-	case FAIL:
-		command, found := sh.findCommandByNameOrAlias(commandOrAlias)
-		if !found {
-			sh.handleCommandOrAliasNotFound(commandOrAlias)
+		line = strings.TrimRight(line, "\r\n")
+		if command.Len() == 0 {
+			if strings.TrimSpace(line) == "" {
+				if eof {
+					break
+				}
+				continue
+			}
+			startLine = lineNo
 		} else {
-			sh.Error(SHELL_PREFIX, "Command failed, Usage: "+command.Usage)
+			command.WriteString("\n")
+		}
+		command.WriteString(line)
+
+		input := command.String()
+		if _, err := parse(input); isIncomplete(err) && !eof {
+			continue
+		}
+		command.Reset()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		stat, _ = sh.withContext(ctx).execute(&input)
+		stop()
+
+		if stat == EXIT || stat == INTERRUPTED || sh.scope.aborted.Load() {
+			break
+		}
+		if sh.failFast && stat != OK {
+			errMsg := fmt.Sprintf("Stopped at line %d, command exited with status %s", startLine, stat)
+			sh.Error(SHELL_PREFIX, errMsg)
+			sh.logger.Error(SHELL_PREFIX, errMsg)
+			break
+		}
+		if eof {
+			break
 		}
-	case NOT_FOUND:
-		sh.handleCommandOrAliasNotFound(commandOrAlias)
 	}
 
-	return OK
+	return stat.ExitCode()
+}
+
+// startInputHandler sets up readline for the interactive loop, it is not
+// created by New since readline starts reading the input stream right away.
+func (sh *Shell) startInputHandler() {
+	completer := &completer{shell: sh}
+	inputHandler, err := NewInputHandler(
+		sh.prompt,
+		sh.historyFile,
+		completer,
+		sh.inStream,
+		sh.outStream,
+		sh.errStream,
+	)
+
+	if err != nil {
+		panic(err)
+	}
+	completer.out = inputHandler.reader
+	sh.inputHandler = inputHandler
 }
 
 func (sh *Shell) read() string {
@@ -427,7 +877,7 @@ func (sh *Shell) clearScreen() {
 		cmd.Stdout = os.Stdout
 		_ = cmd.Run()
 	}
-	if sh.inputHandler.reader != nil {
+	if sh.inputHandler != nil {
 		sh.inputHandler.reader.Refresh()
 	}
 }
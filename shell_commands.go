@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -21,36 +20,46 @@ func (sh *Shell) registerBuiltInCommands() {
 			func(s *Shell, args []string) (Status, error) {
 				return EXIT, nil
 			},
-			func(args []string) (bool, error) {
-				return true, nil
-			},
+			nil,
 		),
 	)
 
 	sh.RegisterCommand(
 		NewCommand(
 			"help",
-			"List all available commands",
-			"help",
-			[]Argument{},
+			"List all available commands, or describe a command and its subcommands",
+			"help [command] [subcommand]...",
+			[]Argument{
+				{
+					Name:        "Command",
+					Description: "The command to describe",
+					Required:    false,
+					Type:        ARG_STRING,
+					Default:     "",
+					Variadic:    true,
+				},
+			},
 			[]string{},
 			func(s *Shell, args []string) (Status, error) {
-				for _, cmd := range sh.GetCommands() {
-					sh.WriteColored(COLOR_YELLOW, cmd.Name+": ")
-					sh.Write(cmd.Description + "\n")
-					sh.Write("    Aliases: ")
-					if len(cmd.Aliases) > 0 {
-						sh.Write(strings.Join(cmd.Aliases, ", ") + "\n")
-					} else {
-						sh.Write("No aliases found.\n")
+				if len(args) == 0 {
+					for _, cmd := range s.GetCommands() {
+						s.writeCommandHelp(cmd)
 					}
-					sh.WriteColored(COLOR_CYAN, "    Usage: "+cmd.Usage+"\n\n")
+					return OK, nil
+				}
+
+				cmd, ok := s.findCommandByNameOrAlias(strings.Join(args, " "))
+				if !ok {
+					return FAIL, fmt.Errorf("command not found: %s", strings.Join(args, " "))
+				}
+
+				s.writeCommandHelp(cmd)
+				for _, sub := range cmd.Subcommands {
+					s.writeCommandHelp(sub)
 				}
 				return OK, nil
 			},
-			func(args []string) (bool, error) {
-				return true, nil
-			},
+			nil,
 		),
 	)
 
@@ -65,9 +74,7 @@ func (sh *Shell) registerBuiltInCommands() {
 				s.clearScreen()
 				return OK, nil
 			},
-			func(args []string) (bool, error) {
-				return true, nil
-			},
+			nil,
 		),
 	)
 
@@ -79,60 +86,122 @@ func (sh *Shell) registerBuiltInCommands() {
 			[]Argument{},
 			[]string{"hist"},
 			func(s *Shell, args []string) (Status, error) {
-				file, err := os.ReadFile(sh.historyFile)
+				file, err := os.ReadFile(s.historyFile)
 				if err != nil {
 					return FAIL, fmt.Errorf("error reading history file: %s", err)
 				}
 
-				sh.Write(string(file))
+				s.Write(string(file))
 				return OK, nil
 			},
-			func(args []string) (bool, error) {
-				return true, nil
-			},
+			nil,
 		),
 	)
 
 	sh.RegisterCommand(
 		NewCommand(
 			"alias",
-			"Create an alias for a command",
-			"alias <alias> <command>",
+			"Create an alias expanding to a command line, show an alias, or list all aliases",
+			"alias [alias] [command line]...",
 			[]Argument{
 				{
 					Name:        "Alias",
-					Description: "The alias to create",
-					Required:    true,
-					Type:        "string",
+					Description: "The alias to create or show",
+					Required:    false,
+					Type:        ARG_STRING,
 					Default:     "",
 				},
 				{
-					Name:        "Command",
-					Description: "The command to create an alias for",
-					Required:    true,
-					Type:        "string",
+					Name:        "Command line",
+					Description: "The command line the alias expands to, $1, $2... are replaced by the arguments of the alias",
+					Required:    false,
+					Type:        ARG_STRING,
 					Default:     "",
+					Variadic:    true,
 				},
 			},
 			[]string{},
 			func(s *Shell, args []string) (Status, error) {
-				cmd, _ := sh.findCommandByNameOrAlias(args[1])
-				sh.addAlias(args[0], cmd.Name)
+				if len(args) == 0 {
+					for _, name := range s.aliases.names() {
+						expansion, _ := s.aliases.get(name)
+						s.Write(name + "=" + expansion + "\n")
+					}
+					return OK, nil
+				}
+
+				if len(args) == 1 {
+					expansion, ok := s.aliases.get(args[0])
+					if !ok {
+						return FAIL, fmt.Errorf("alias not found: %s", args[0])
+					}
+					s.Write(args[0] + "=" + expansion + "\n")
+					return OK, nil
+				}
+
+				// A single argument is the command line as typed, several
+				// arguments are quoted back into one
+				expansion := args[1]
+				if len(args) > 2 {
+					quoted := make([]string, len(args)-1)
+					for i, arg := range args[1:] {
+						quoted[i] = quoteArg(arg)
+					}
+					expansion = strings.Join(quoted, " ")
+				}
+
+				if err := s.aliases.set(args[0], expansion); err != nil {
+					s.Warn(COMMAND_PREFIX, "Alias not saved, "+err.Error())
+					s.logger.Warn(SHELL_PREFIX, fmt.Sprintf("Error saving alias %s: %s", args[0], err))
+				}
 				return OK, nil
 			},
 			func(args []string) (bool, error) {
-				if len(args) != 2 {
-					return false, fmt.Errorf("invalid number of arguments")
+				if len(args) > 0 && !isValidAliasName(args[0]) {
+					return false, fmt.Errorf("invalid alias name: %s", args[0])
 				}
-
-				if _, ok := sh.findCommandByNameOrAlias(args[1]); !ok {
-					return false, fmt.Errorf("command or alias not found")
+				if len(args) > 1 && strings.Contains(strings.Join(args[1:], " "), "\n") {
+					return false, fmt.Errorf("command line of an alias must fit on one line")
 				}
+
 				return true, nil
 			},
 		),
 	)
 
+	sh.RegisterCommand(
+		NewCommand(
+			"unalias",
+			"Remove aliases",
+			"unalias <alias>...",
+			[]Argument{
+				{
+					Name:        "Alias",
+					Description: "The alias to remove",
+					Required:    true,
+					Type:        ARG_STRING,
+					Default:     "",
+					Variadic:    true,
+				},
+			},
+			[]string{},
+			func(s *Shell, args []string) (Status, error) {
+				for _, name := range args {
+					ok, err := s.aliases.remove(name)
+					if !ok {
+						return FAIL, fmt.Errorf("alias not found: %s", name)
+					}
+					if err != nil {
+						s.Warn(COMMAND_PREFIX, "Alias removal not saved, "+err.Error())
+						s.logger.Warn(SHELL_PREFIX, fmt.Sprintf("Error saving aliases after removing %s: %s", name, err))
+					}
+				}
+				return OK, nil
+			},
+			nil,
+		),
+	)
+
 	sh.RegisterCommand(
 		NewCommand(
 			"exec",
@@ -143,35 +212,28 @@ func (sh *Shell) registerBuiltInCommands() {
 					Name:        "Execute command",
 					Description: "The command to execute",
 					Required:    true,
-					Type:        "string",
+					Type:        ARG_STRING,
 					Default:     "",
+					Variadic:    true,
 				},
 			},
 			[]string{},
 			func(s *Shell, args []string) (Status, error) {
-				var ar []string
-
-				for i := 0; i < len(args); i++ {
-					s := args[i]
-					if strings.HasPrefix(args[i], "\"") {
-						s = strings.TrimPrefix(s, "\"")
-						i++
-						for i < len(args) && !strings.HasSuffix(args[i], "\"") {
-							s += " " + args[i]
-							i++
-						}
-						if i < len(args) {
-							s += " " + strings.TrimSuffix(args[i], "\"")
-						}
+				cmd := exec.CommandContext(s.Context(), args[0], args[1:]...)
+				// Ask the child to stop like Ctrl+C would, then kill it if it
+				// is still running after a grace period
+				cmd.Cancel = func() error {
+					if err := cmd.Process.Signal(os.Interrupt); err != nil {
+						return cmd.Process.Kill()
 					}
-					ar = append(ar, s)
+					return nil
 				}
+				cmd.WaitDelay = 3 * time.Second
 
-				cmd := exec.Command(ar[0], ar[1:]...)
-
-				cmd.Stdout = sh.outStream
-				cmd.Stderr = sh.errStream
-				cmd.Stdin = sh.inStream
+				cmd.Stdout = s.outStream
+				cmd.Stderr = s.errStream
+				cmd.Stdin = s.inStream
+				cmd.Env = s.environ()
 
 				err := cmd.Run()
 
@@ -181,53 +243,292 @@ func (sh *Shell) registerBuiltInCommands() {
 
 				return OK, nil
 			},
-			func(args []string) (bool, error) {
-				if len(args) < 1 {
-					return false, fmt.Errorf("no command provided")
-				}
-
-				return true, nil
-			},
+			nil,
 		),
 	)
 
 	sh.RegisterCommand(
 		NewCommand(
 			"run",
-			"Run a script",
-			"run <script_path.shell>",
+			"Run a script in a child scope, with the given arguments as $1, $2...",
+			"run <script_path.shell> [argument]...",
 			[]Argument{
 				{
 					Name:        "Script Path",
 					Description: "The path to the script to run",
 					Required:    true,
-					Type:        "string",
+					Type:        ARG_PATH,
+					Default:     "",
+					Path:        PathOptions{FilesOnly: true, Exists: true, Extensions: []string{".shell"}},
+				},
+				{
+					Name:        "Arguments",
+					Description: "The arguments of the script",
+					Required:    false,
+					Type:        ARG_STRING,
 					Default:     "",
+					Variadic:    true,
 				},
 			},
 			[]string{},
 			func(s *Shell, args []string) (Status, error) {
-				file, err := os.ReadFile(args[0])
+				return s.runScript(expandHome(args[0]), args[1:])
+			},
+			nil,
+		),
+	)
+
+	sh.RegisterCommand(
+		NewCommand(
+			"source",
+			"Run a file in the current scope, keeping the variables, functions and aliases it defines",
+			"source <file_path> [argument]...",
+			[]Argument{
+				{
+					Name:        "File Path",
+					Description: "The path to the file to run",
+					Required:    true,
+					Type:        ARG_PATH,
+					Default:     "",
+					Path:        PathOptions{FilesOnly: true, Exists: true},
+				},
+				{
+					Name:        "Arguments",
+					Description: "The arguments of the file, the current ones by default",
+					Required:    false,
+					Type:        ARG_STRING,
+					Default:     "",
+					Variadic:    true,
+				},
+			},
+			[]string{"."},
+			func(s *Shell, args []string) (Status, error) {
+				return s.sourceFile(expandHome(args[0]), args[1:])
+			},
+			nil,
+		),
+	)
+
+	sh.RegisterCommand(
+		&Command{
+			Name:        "sleep",
+			Description: "idle the shell for a specified time",
+			Usage:       "sleep <seconds>",
+			Args: []Argument{
+				{
+					Name:        "Seconds",
+					Description: "The number of seconds to idle",
+					Required:    true,
+					Type:        ARG_INT,
+					Default:     "",
+				},
+			},
+			Aliases: []string{},
+			Run: func(inv *Invocation) (Status, error) {
+				select {
+				case <-time.After(time.Duration(inv.Int("Seconds")) * time.Second):
+					return OK, nil
+				case <-inv.Context().Done():
+					return INTERRUPTED, nil
+				}
+			},
+			ValidateArgs: func(args []string) (bool, error) {
+				sec, _ := strconv.Atoi(args[0])
+				if sec < 0 {
+					return false, fmt.Errorf("number of seconds must be positive")
+				}
+
+				return true, nil
+			},
+		},
+	)
+
+	sh.RegisterCommand(
+		&Command{
+			Name:        "jobs",
+			Description: "List the background jobs with their status and elapsed time",
+			Usage:       "jobs",
+			Args:        []Argument{},
+			Aliases:     []string{},
+			Run: func(inv *Invocation) (Status, error) {
+				for _, j := range inv.Shell.jobs.list() {
+					inv.Shell.Write(fmt.Sprintf("[%d] %-12s %8s  %s\n", j.id, j.state(), j.elapsed(), j.line))
+				}
+				return OK, nil
+			},
+		},
+	)
+
+	sh.RegisterCommand(
+		&Command{
+			Name:        "fg",
+			Description: "Bring a background job to the foreground and show its output",
+			Usage:       "fg [job]",
+			Args: []Argument{
+				{
+					Name:        "Job",
+					Description: "The number of the job, the last started job by default",
+					Required:    false,
+					Type:        ARG_INT,
+					Default:     "0",
+				},
+			},
+			Aliases: []string{},
+			Run: func(inv *Invocation) (Status, error) {
+				j, err := inv.Shell.jobs.get(inv.Int("Job"))
+				if err != nil {
+					return FAIL, err
+				}
+
+				inv.Shell.Write(j.line + "\n")
+				return jobStatus(j, inv.Shell.foreground(j))
+			},
+		},
+	)
+
+	sh.RegisterCommand(
+		&Command{
+			Name:        "wait",
+			Description: "Wait for a background job, or for all of them, to finish and show their output",
+			Usage:       "wait [job]",
+			Args: []Argument{
+				{
+					Name:        "Job",
+					Description: "The number of the job, all jobs by default",
+					Required:    false,
+					Type:        ARG_INT,
+					Default:     "0",
+				},
+			},
+			Aliases: []string{},
+			Run: func(inv *Invocation) (Status, error) {
+				jobs := inv.Shell.jobs.list()
+				if inv.Int("Job") != 0 {
+					j, err := inv.Shell.jobs.get(inv.Int("Job"))
+					if err != nil {
+						return FAIL, err
+					}
+					jobs = []*job{j}
+				}
+
+				for _, j := range jobs {
+					select {
+					case <-j.done:
+					case <-inv.Context().Done():
+						return INTERRUPTED, nil
+					}
+					// Collect the job, writing the output it buffered
+					inv.Shell.foreground(j)
+				}
+
+				if len(jobs) == 1 {
+					return jobStatus(jobs[0], jobs[0].status)
+				}
+				return OK, nil
+			},
+		},
+	)
+
+	sh.RegisterCommand(
+		&Command{
+			Name:        "kill",
+			Description: "Cancel a background job",
+			Usage:       "kill <job>",
+			Args: []Argument{
+				{
+					Name:        "Job",
+					Description: "The number of the job",
+					Required:    true,
+					Type:        ARG_INT,
+					Default:     "",
+				},
+			},
+			Aliases: []string{},
+			Run: func(inv *Invocation) (Status, error) {
+				j, err := inv.Shell.jobs.get(inv.Int("Job"))
 				if err != nil {
-					return FAIL, fmt.Errorf("error reading script file: %s", err)
+					return FAIL, err
 				}
 
-				lines := strings.Split(string(file), "\n")
-				for _, line := range lines {
-					sh.execute(&line)
+				j.cancel()
+				return OK, nil
+			},
+		},
+	)
+
+	sh.RegisterCommand(
+		NewCommand(
+			"status",
+			"Show the status, exit code and error of the last command",
+			"status",
+			[]Argument{},
+			[]string{},
+			func(s *Shell, args []string) (Status, error) {
+				stat, err := s.last.get()
+				line := fmt.Sprintf("%s (%d)", stat, s.last.exitCode())
+				if err != nil {
+					line += ": " + err.Error()
 				}
 
+				s.Write(line + "\n")
+				return OK, nil
+			},
+			nil,
+		),
+	)
+
+	sh.RegisterCommand(
+		NewCommand(
+			"set",
+			"Set a shell variable, list all variables, or set script options: -e aborts on failure, -x traces commands, -u fails on unset variables",
+			"set [name] [value] | set -e|-x|-u|+e|+x|+u",
+			[]Argument{
+				{
+					Name:        "Name",
+					Description: "The name of the variable",
+					Required:    false,
+					Type:        ARG_STRING,
+					Default:     "",
+				},
+				{
+					Name:        "Value",
+					Description: "The value of the variable",
+					Required:    false,
+					Type:        ARG_STRING,
+					Default:     "",
+				},
+			},
+			[]string{},
+			func(s *Shell, args []string) (Status, error) {
+				if len(args) == 0 {
+					for _, name := range s.varNames(false) {
+						value, _ := s.GetVar(name)
+						s.Write(name + "=" + value + "\n")
+					}
+					return OK, nil
+				}
+
+				if isOptionArg(args[0]) {
+					return OK, s.scope.opts.set(args[0])
+				}
+
+				value := ""
+				if len(args) == 2 {
+					value = args[1]
+				}
+				s.SetVar(args[0], value)
 				return OK, nil
 			},
 			func(args []string) (bool, error) {
-				if len(args) != 1 {
-					return false, fmt.Errorf("invalid number of arguments")
+				if len(args) > 0 && isOptionArg(args[0]) {
+					if len(args) > 1 {
+						return false, fmt.Errorf("options take no value")
+					}
+					return true, nil
 				}
 
-				if info, err := os.Stat(args[0]); os.IsNotExist(err) {
-					return false, fmt.Errorf("file does not exist")
-				} else if info.IsDir() || filepath.Ext(args[0]) != ".shell" {
-					return false, fmt.Errorf("invalid file type")
+				if len(args) > 0 && !isValidVarName(args[0]) {
+					return false, fmt.Errorf("invalid variable name: %s", args[0])
 				}
 
 				return true, nil
@@ -237,36 +538,70 @@ func (sh *Shell) registerBuiltInCommands() {
 
 	sh.RegisterCommand(
 		NewCommand(
-			"sleep",
-			"idle the shell for a specified time",
-			"sleep <seconds>",
+			"unset",
+			"Remove shell variables",
+			"unset <name>...",
 			[]Argument{
 				{
-					Name:        "Seconds",
-					Description: "The number of seconds to idle",
+					Name:        "Name",
+					Description: "The name of the variable to remove",
 					Required:    true,
-					Type:        "int",
+					Type:        ARG_STRING,
 					Default:     "",
+					Variadic:    true,
 				},
 			},
 			[]string{},
 			func(s *Shell, args []string) (Status, error) {
-				sec, _ := strconv.Atoi(args[0])
-				time.Sleep(time.Duration(sec) * time.Second)
+				for _, name := range args {
+					s.UnsetVar(name)
+				}
 				return OK, nil
 			},
-			func(args []string) (bool, error) {
-				if len(args) != 1 {
-					return false, fmt.Errorf("invalid number of arguments")
-				}
+			nil,
+		),
+	)
 
-				sec, err := strconv.Atoi(args[0])
-				if err != nil {
-					return false, fmt.Errorf("invalid number of seconds: %s", err)
+	sh.RegisterCommand(
+		NewCommand(
+			"export",
+			"Pass a shell variable to the environment of external commands, or list exported variables",
+			"export [name] [value]",
+			[]Argument{
+				{
+					Name:        "Name",
+					Description: "The name of the variable to export",
+					Required:    false,
+					Type:        ARG_STRING,
+					Default:     "",
+				},
+				{
+					Name:        "Value",
+					Description: "The new value of the variable",
+					Required:    false,
+					Type:        ARG_STRING,
+					Default:     "",
+				},
+			},
+			[]string{},
+			func(s *Shell, args []string) (Status, error) {
+				if len(args) == 0 {
+					for _, name := range s.varNames(true) {
+						value, _ := s.GetVar(name)
+						s.Write(name + "=" + value + "\n")
+					}
+					return OK, nil
 				}
 
-				if sec < 0 {
-					return false, fmt.Errorf("number of seconds must be positive")
+				if len(args) == 2 {
+					s.SetVar(args[0], args[1])
+				}
+				s.ExportVar(args[0])
+				return OK, nil
+			},
+			func(args []string) (bool, error) {
+				if len(args) > 0 && !isValidVarName(args[0]) {
+					return false, fmt.Errorf("invalid variable name: %s", args[0])
 				}
 
 				return true, nil
@@ -274,3 +609,12 @@ func (sh *Shell) registerBuiltInCommands() {
 		),
 	)
 }
+
+// jobStatus reports a job that did not succeed as a failure of the command
+// that collected it.
+func jobStatus(j *job, stat Status) (Status, error) {
+	if stat != OK {
+		return FAIL, fmt.Errorf("job %d finished with status %s", j.id, stat)
+	}
+	return OK, nil
+}
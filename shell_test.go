@@ -0,0 +1,181 @@
+package gshell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestShell returns a shell writing to buffers, with its files in a
+// temporary directory and the commands:
+//   - echo, writing its args,
+//   - fail, failing with an error,
+//   - both, writing "out" to the output stream and "err" to the error stream.
+//
+// The given options are applied after the default ones.
+func newTestShell(t *testing.T, options ...Option) (sh *Shell, out, errOut *bytes.Buffer) {
+	t.Helper()
+
+	dir := t.TempDir()
+	out, errOut = &bytes.Buffer{}, &bytes.Buffer{}
+	sh = New(append([]Option{
+		WithInputStream(io.NopCloser(strings.NewReader(""))),
+		WithOutputStream(out),
+		WithErrorStream(errOut),
+		WithHistoryFile(filepath.Join(dir, "history")),
+		WithAliasFile(filepath.Join(dir, "aliases")),
+		WithLogger(NewLogger(filepath.Join(dir, "gshell.log"))),
+	}, options...)...)
+	t.Cleanup(func() { _ = sh.logger.Close() })
+
+	sh.RegisterCommand(NewCommand("echo", "Write the args", "echo [arg]...", nil, nil,
+		func(s *Shell, args []string) (Status, error) {
+			s.Write(strings.Join(args, " ") + "\n")
+			return OK, nil
+		}, nil))
+	sh.RegisterCommand(NewCommand("fail", "Fail", "fail", nil, nil,
+		func(s *Shell, args []string) (Status, error) {
+			return FAIL, fmt.Errorf("failed")
+		}, nil))
+	sh.RegisterCommand(NewCommand("both", "Write to both streams", "both", nil, nil,
+		func(s *Shell, args []string) (Status, error) {
+			s.Write("out\n")
+			_, _ = s.errStream.Write([]byte("err\n"))
+			return OK, nil
+		}, nil))
+
+	return sh, out, errOut
+}
+
+// registerBlocking registers the commands:
+//   - block, returning once its context is done,
+//   - stubborn, ignoring its context and returning after d.
+func registerBlocking(sh *Shell, d time.Duration) {
+	sh.RegisterCommand(NewCommand("block", "Block until cancelled", "block", nil, nil,
+		func(s *Shell, args []string) (Status, error) {
+			<-s.Context().Done()
+			return OK, nil
+		}, nil))
+	sh.RegisterCommand(NewCommand("stubborn", "Ignore cancellation", "stubborn", nil, nil,
+		func(s *Shell, args []string) (Status, error) {
+			time.Sleep(d)
+			return OK, nil
+		}, nil))
+}
+
+func TestInterrupt(t *testing.T) {
+	tests := []string{
+		"block",
+		"stubborn",
+		"exec sleep 10",
+		"block; echo a",
+		"block || echo a",
+		"while echo a > /dev/null; do block; done",
+		"for x in a b c; do block; done",
+	}
+
+	for _, line := range tests {
+		sh, out, _ := newTestShell(t)
+		registerBlocking(sh, 10*time.Second)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		start := time.Now()
+		stat, err := sh.withContext(ctx).Exec(line)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: returned after %s", line, elapsed)
+		}
+		if stat != INTERRUPTED || !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: got %s (%v), want %s", line, stat, err, INTERRUPTED)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%s: got output %q after the interrupt", line, out.String())
+		}
+		cancel()
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		timeout        time.Duration // Timeout of the shell
+		commandTimeout time.Duration // Timeout of the command
+		stat           Status
+	}{
+		{0, 0, OK},
+		{20 * time.Millisecond, 0, TIMEOUT},
+		{0, 20 * time.Millisecond, TIMEOUT},
+		{time.Minute, 20 * time.Millisecond, TIMEOUT},
+		{20 * time.Millisecond, time.Minute, OK},
+		{20 * time.Millisecond, -1, OK},
+	}
+
+	for _, tt := range tests {
+		sh, _, errOut := newTestShell(t, WithCommandTimeout(tt.timeout))
+		sh.RegisterCommand(&Command{
+			Name:    "slow",
+			Timeout: tt.commandTimeout,
+			Handler: func(s *Shell, args []string) (Status, error) {
+				select {
+				case <-s.Context().Done():
+				case <-time.After(200 * time.Millisecond):
+				}
+				return OK, nil
+			},
+		})
+
+		stat, err := sh.Exec("slow")
+		if stat != tt.stat {
+			t.Errorf("timeouts %s and %s: got %s (%v), want %s", tt.timeout, tt.commandTimeout, stat, err, tt.stat)
+		}
+		if stat == TIMEOUT && !strings.Contains(errOut.String(), "Command slow timed out after 20ms") {
+			t.Errorf("timeouts %s and %s: got errors %q", tt.timeout, tt.commandTimeout, errOut.String())
+		}
+	}
+}
+
+func TestTimeoutStatus(t *testing.T) {
+	sh, out, _ := newTestShell(t, WithCommandTimeout(20*time.Millisecond))
+	registerBlocking(sh, 0)
+
+	stat, _ := sh.Exec("block || echo $?; block; echo $?")
+	if stat != OK || out.String() != "124\n124\n" {
+		t.Errorf("got %s with output %q, want OK with output %q", stat, out.String(), "124\n124\n")
+	}
+	if code := TIMEOUT.ExitCode(); code != 124 {
+		t.Errorf("got exit code %d, want 124", code)
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	tests := []struct {
+		name      string
+		suggested string // Empty when nothing should be suggested
+	}{
+		{"ech", "did you mean `echo`?"},
+		{"bith", "did you mean `both`?"},
+		{"sourc", "did you mean `source`?"},
+		{"x", ""},
+		{"ab", ""},
+		{"..", ""},
+		{"echoecho", ""},
+	}
+
+	for _, tt := range tests {
+		sh, _, errOut := newTestShell(t)
+
+		if stat, _ := sh.Exec(tt.name); stat != NOT_FOUND {
+			t.Errorf("%s: got %s, want %s", tt.name, stat, NOT_FOUND)
+		}
+		if got := errOut.String(); tt.suggested == "" && strings.Contains(got, "did you mean") ||
+			!strings.Contains(got, tt.suggested) {
+			t.Errorf("%s: got errors %q, want %q", tt.name, got, tt.suggested)
+		}
+	}
+}
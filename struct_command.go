@@ -0,0 +1,232 @@
+package gshell
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CommandRunner is implemented by the structs given to NewStructCommand.
+type CommandRunner interface {
+	Run(sh *Shell) error
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// NewStructCommand builds a command from a pointer to a struct whose tagged
+// fields declare its arguments and flags:
+//
+//	type Greet struct {
+//		Name  string `arg:"name,required" help:"Who to greet"`
+//		Times int    `flag:"times,t" default:"1" help:"How many times"`
+//	}
+//
+//	func (g *Greet) Run(sh *Shell) error { ... }
+//
+// Arguments are declared in field order with `arg:"name[,required]"`, a
+// []string argument must be the last one and takes all the remaining args.
+// Flags are declared with `flag:"name[,short][,required]"`. Both accept the
+// `help` and `default` tags, and string arguments the `enum:"a,b,c"` tag.
+// Tagged fields must be exported. Supported field types are string, int,
+// float64 (arguments only), bool, time.Duration and []string.
+//
+// Each run works on a fresh copy of spec with the parsed values assigned to
+// its fields, then calls its Run method.
+func NewStructCommand(name, description string, spec CommandRunner) (*Command, error) {
+	specValue := reflect.ValueOf(spec)
+	if specValue.Kind() != reflect.Pointer || specValue.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("command %s: spec must be a pointer to a struct, got %T", name, spec)
+	}
+
+	cmd := &Command{Name: name, Description: description}
+	var argFields, flagFields []int
+
+	structType := specValue.Elem().Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		_, isArg := field.Tag.Lookup("arg")
+		_, isFlag := field.Tag.Lookup("flag")
+		if (isArg || isFlag) && !field.IsExported() {
+			return nil, fmt.Errorf("command %s: field %s: tagged field must be exported", name, field.Name)
+		}
+
+		if tag, ok := field.Tag.Lookup("arg"); ok {
+			arg, err := structArgument(field, tag)
+			if err != nil {
+				return nil, fmt.Errorf("command %s: field %s: %s", name, field.Name, err)
+			}
+			if n := len(cmd.Args); n > 0 && cmd.Args[n-1].Variadic {
+				return nil, fmt.Errorf("command %s: field %s: argument after variadic argument %s", name, field.Name, cmd.Args[n-1].Name)
+			}
+			cmd.Args = append(cmd.Args, arg)
+			argFields = append(argFields, i)
+		} else if tag, ok := field.Tag.Lookup("flag"); ok {
+			flag, err := structFlag(field, tag)
+			if err != nil {
+				return nil, fmt.Errorf("command %s: field %s: %s", name, field.Name, err)
+			}
+			cmd.Flags = append(cmd.Flags, flag)
+			flagFields = append(flagFields, i)
+		}
+	}
+
+	cmd.Usage = structUsage(cmd)
+	cmd.Run = func(inv *Invocation) (Status, error) {
+		instance := reflect.New(structType)
+		instance.Elem().Set(specValue.Elem())
+
+		for i, arg := range cmd.Args {
+			field := instance.Elem().Field(argFields[i])
+			if arg.Variadic {
+				field.Set(reflect.ValueOf(inv.Strings(arg.Name)))
+			} else if inv.Has(arg.Name) {
+				field.Set(reflect.ValueOf(inv.value(arg.Name)).Convert(field.Type()))
+			}
+		}
+
+		for i, flag := range cmd.Flags {
+			if v := inv.Flags().get(flag.Name); v != nil {
+				field := instance.Elem().Field(flagFields[i])
+				field.Set(reflect.ValueOf(v).Convert(field.Type()))
+			}
+		}
+
+		if err := instance.Interface().(CommandRunner).Run(inv.Shell); err != nil {
+			return FAIL, err
+		}
+		return OK, nil
+	}
+
+	return cmd, nil
+}
+
+// RegisterStruct registers a command built by NewStructCommand.
+func (sh *Shell) RegisterStruct(name, description string, spec CommandRunner) error {
+	cmd, err := NewStructCommand(name, description, spec)
+	if err != nil {
+		return err
+	}
+
+	sh.RegisterCommand(cmd)
+	return nil
+}
+
+func structArgument(field reflect.StructField, tag string) (Argument, error) {
+	parts := strings.Split(tag, ",")
+	arg := Argument{
+		Name:        parts[0],
+		Description: field.Tag.Get("help"),
+		Default:     field.Tag.Get("default"),
+	}
+	if arg.Name == "" {
+		arg.Name = field.Name
+	}
+
+	for _, option := range parts[1:] {
+		switch option {
+		case "required":
+			arg.Required = true
+		default:
+			return arg, fmt.Errorf("unknown arg option %q", option)
+		}
+	}
+
+	switch {
+	case field.Type == durationType:
+		arg.Type = ARG_DURATION
+	case field.Type.Kind() == reflect.String:
+		arg.Type = ARG_STRING
+		if enum, ok := field.Tag.Lookup("enum"); ok {
+			arg.Type = ARG_ENUM
+			arg.Enum = strings.Split(enum, ",")
+		}
+	case field.Type.Kind() == reflect.Int:
+		arg.Type = ARG_INT
+	case field.Type.Kind() == reflect.Float64:
+		arg.Type = ARG_FLOAT
+	case field.Type.Kind() == reflect.Bool:
+		arg.Type = ARG_BOOL
+	case field.Type == reflect.TypeOf([]string(nil)):
+		arg.Type = ARG_STRING
+		arg.Variadic = true
+	default:
+		return arg, fmt.Errorf("unsupported argument type %s", field.Type)
+	}
+
+	return arg, nil
+}
+
+func structFlag(field reflect.StructField, tag string) (Flag, error) {
+	parts := strings.Split(tag, ",")
+	flag := Flag{
+		Name:        parts[0],
+		Description: field.Tag.Get("help"),
+		Default:     field.Tag.Get("default"),
+	}
+	if flag.Name == "" {
+		flag.Name = strings.ToLower(field.Name)
+	}
+
+	for _, option := range parts[1:] {
+		switch {
+		case option == "required":
+			flag.Required = true
+		case len(option) == 1:
+			flag.Short = option
+		default:
+			return flag, fmt.Errorf("unknown flag option %q", option)
+		}
+	}
+
+	switch {
+	case field.Type == durationType:
+		flag.Type = FLAG_DURATION
+	case field.Type.Kind() == reflect.String:
+		flag.Type = FLAG_STRING
+	case field.Type.Kind() == reflect.Int:
+		flag.Type = FLAG_INT
+	case field.Type.Kind() == reflect.Bool:
+		flag.Type = FLAG_BOOL
+	case field.Type == reflect.TypeOf([]string(nil)):
+		flag.Type = FLAG_SLICE
+	default:
+		return flag, fmt.Errorf("unsupported flag type %s", field.Type)
+	}
+
+	return flag, nil
+}
+
+// structUsage builds a usage like `deploy <env> [version] [--force] [--tag <slice>]`.
+func structUsage(cmd *Command) string {
+	usage := []string{cmd.Name}
+
+	for _, arg := range cmd.Args {
+		name := arg.Name
+		if arg.Variadic {
+			name += "..."
+		}
+
+		if arg.Required {
+			usage = append(usage, "<"+name+">")
+		} else {
+			usage = append(usage, "["+name+"]")
+		}
+	}
+
+	for _, flag := range cmd.Flags {
+		name := "--" + flag.Name
+		if flag.Type != FLAG_BOOL {
+			name += " <" + string(flag.Type) + ">"
+		}
+
+		if flag.Required {
+			usage = append(usage, name)
+		} else {
+			usage = append(usage, "["+name+"]")
+		}
+	}
+
+	return strings.Join(usage, " ")
+}
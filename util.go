@@ -1,8 +1,12 @@
 package gshell
 
 import (
+	"bytes"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"golang.org/x/term"
 )
@@ -46,9 +50,50 @@ func editDistance(a, b string) int {
 }
 
 func isTerminal(w io.Writer) bool {
-	if f, ok := w.(*os.File); ok {
-		return term.IsTerminal(int(f.Fd()))
+	switch w := w.(type) {
+	case *os.File:
+		return term.IsTerminal(int(w.Fd()))
+	case *syncWriter:
+		return isTerminal(w.w)
+	case *io.PipeWriter, *bytes.Buffer, *jobOutput:
+		return false
 	}
 
 	return w != nil && w != os.Stdout && w != os.Stderr
 }
+
+// expandHome replaces a leading ~ in path with the home directory of the user.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// quoteArg quotes s, if needed, so that the lexer reads it back as a single
+// word.
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$;&|<>#`") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// syncWriter serializes writes to w, for outputs shared by the concurrent
+// commands of a pipeline.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	return sw.w.Write(p)
+}
@@ -0,0 +1,155 @@
+package gshell
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validateArgs runs the validation derived from the Args declared by the
+// command, then its own ValidateArgs, if any, for extra rules.
+func (cmd *Command) validateArgs(args []string) ([]string, map[string]any, error) {
+	args, values, err := cmd.checkArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cmd.ValidateArgs != nil {
+		if ok, err := cmd.ValidateArgs(args); !ok {
+			if err == nil {
+				err = fmt.Errorf("rejected by the command")
+			}
+			return nil, nil, err
+		}
+	}
+
+	return args, values, nil
+}
+
+// checkArgs validates args against the Args declared by the command: the
+// number of args from Required and Variadic, the type of each arg and the
+// values of enums. Missing optional args with a Default are filled in, the
+// completed args are returned with their parsed values keyed by Argument.Name,
+// a variadic argument holding the slice of all its values. A command
+// declaring no Args accepts any args.
+func (cmd *Command) checkArgs(args []string) ([]string, map[string]any, error) {
+	values := make(map[string]any)
+	if len(cmd.Args) == 0 {
+		return args, values, nil
+	}
+
+	for i, arg := range cmd.Args {
+		if i < len(args) {
+			continue
+		}
+
+		if arg.Required {
+			return nil, nil, fmt.Errorf("missing required argument <%s>", arg.Name)
+		}
+
+		// Defaults can only be filled in order, an optional arg without
+		// default leaves the ones after it empty too.
+		if arg.Default == "" {
+			break
+		}
+		args = append(args, arg.Default)
+	}
+
+	last := cmd.Args[len(cmd.Args)-1]
+	if len(args) > len(cmd.Args) && !last.Variadic {
+		return nil, nil, fmt.Errorf("too many arguments, expected at most %d", len(cmd.Args))
+	}
+
+	for i, value := range args {
+		arg := last
+		if i < len(cmd.Args) {
+			arg = cmd.Args[i]
+		}
+
+		parsed, err := arg.parse(value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if arg.Variadic {
+			all, _ := values[arg.Name].([]any)
+			parsed = append(all, parsed)
+		}
+		values[arg.Name] = parsed
+	}
+
+	return args, values, nil
+}
+
+// parse converts value to the Go type of the argument: string, int, float64,
+// bool or time.Duration.
+func (arg *Argument) parse(value string) (any, error) {
+	var parsed any
+	var err error
+
+	switch arg.Type {
+	case ARG_INT:
+		parsed, err = strconv.Atoi(value)
+	case ARG_FLOAT:
+		parsed, err = strconv.ParseFloat(value, 64)
+	case ARG_BOOL:
+		parsed, err = strconv.ParseBool(value)
+	case ARG_DURATION:
+		parsed, err = time.ParseDuration(value)
+	case ARG_PATH:
+		if value == "" {
+			return nil, fmt.Errorf("invalid value for argument <%s>, expected a path", arg.Name)
+		}
+		if err := arg.Path.check(expandHome(value)); err != nil {
+			return nil, fmt.Errorf("invalid value %q for argument <%s>, %s", value, arg.Name, err)
+		}
+		parsed = value
+	case ARG_ENUM:
+		if !slices.Contains(arg.Enum, value) {
+			return nil, fmt.Errorf("invalid value %q for argument <%s>, expected one of: %s", value, arg.Name, strings.Join(arg.Enum, ", "))
+		}
+		parsed = value
+	default:
+		parsed = value
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for argument <%s>, expected %s", value, arg.Name, arg.Type)
+	}
+	return parsed, nil
+}
+
+// check validates a path against the options, a path that does not exist is
+// only rejected if it must exist.
+func (opts *PathOptions) check(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
+			}
+			return fmt.Errorf("cannot access path: %s", err)
+		}
+		if opts.Exists {
+			return fmt.Errorf("no such file or directory")
+		}
+		return nil
+	}
+
+	switch {
+	case opts.FilesOnly && info.IsDir():
+		return fmt.Errorf("expected a file")
+	case opts.DirsOnly && !info.IsDir():
+		return fmt.Errorf("expected a directory")
+	case len(opts.Extensions) > 0 && !info.IsDir() && !slices.Contains(opts.Extensions, filepath.Ext(path)):
+		return fmt.Errorf("expected a file ending with %s", strings.Join(opts.Extensions, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package gshell
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheckArgs(t *testing.T) {
+	cmd := &Command{Args: []Argument{
+		{Name: "n", Type: ARG_INT, Required: true},
+		{Name: "d", Type: ARG_DURATION, Default: "1m"},
+		{Name: "mode", Type: ARG_ENUM, Enum: []string{"fast", "safe"}, Default: "safe"},
+	}}
+	variadic := &Command{Args: []Argument{
+		{Name: "first", Type: ARG_STRING, Required: true},
+		{Name: "rest", Type: ARG_INT, Variadic: true},
+	}}
+	noDefault := &Command{Args: []Argument{
+		{Name: "a", Type: ARG_STRING},
+		{Name: "b", Type: ARG_STRING, Default: "x"},
+	}}
+
+	tests := []struct {
+		cmd  *Command
+		args []string
+		want []string
+	}{
+		{cmd, []string{"1"}, []string{"1", "1m", "safe"}},
+		{cmd, []string{"1", "5s"}, []string{"1", "5s", "safe"}},
+		{cmd, []string{"1", "5s", "fast"}, []string{"1", "5s", "fast"}},
+		{variadic, []string{"a"}, []string{"a"}},
+		{variadic, []string{"a", "1", "2", "3"}, []string{"a", "1", "2", "3"}},
+		{noDefault, nil, nil},
+		{noDefault, []string{"y"}, []string{"y", "x"}},
+		{&Command{}, []string{"any", "args"}, []string{"any", "args"}},
+	}
+
+	for _, tt := range tests {
+		got, _, err := tt.cmd.checkArgs(tt.args)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCheckArgsValues(t *testing.T) {
+	cmd := &Command{Args: []Argument{
+		{Name: "n", Type: ARG_INT},
+		{Name: "f", Type: ARG_FLOAT},
+		{Name: "b", Type: ARG_BOOL},
+		{Name: "d", Type: ARG_DURATION},
+		{Name: "rest", Type: ARG_INT, Variadic: true},
+	}}
+
+	_, values, err := cmd.checkArgs([]string{"3", "1.5", "true", "2s", "4", "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values["n"] != 3 || values["f"] != 1.5 || values["b"] != true || values["d"] != 2*time.Second {
+		t.Errorf("got %v", values)
+	}
+	if rest, _ := values["rest"].([]any); !slices.Equal(rest, []any{4, 5}) {
+		t.Errorf("got rest %v, want [4 5]", values["rest"])
+	}
+}
+
+func TestCheckArgsErrors(t *testing.T) {
+	dir := t.TempDir()
+	script, text := filepath.Join(dir, "a.shell"), filepath.Join(dir, "a.txt")
+	for _, name := range []string{script, text} {
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := &Command{Args: []Argument{
+		{Name: "n", Type: ARG_INT, Required: true},
+		{Name: "mode", Type: ARG_ENUM, Enum: []string{"fast", "safe"}},
+	}}
+	path := &Command{Args: []Argument{
+		{Name: "script", Type: ARG_PATH, Path: PathOptions{FilesOnly: true, Exists: true, Extensions: []string{".shell"}}},
+	}}
+
+	tests := []struct {
+		cmd  *Command
+		args []string
+		err  string
+	}{
+		{cmd, nil, "missing required argument <n>"},
+		{cmd, []string{"1", "fast", "x"}, "too many arguments, expected at most 2"},
+		{cmd, []string{"one"}, `invalid value "one" for argument <n>, expected int`},
+		{cmd, []string{"1", "slow"}, `invalid value "slow" for argument <mode>, expected one of: fast, safe`},
+		{path, []string{dir}, `invalid value "` + dir + `" for argument <script>, expected a file`},
+		{path, []string{text}, `invalid value "` + text + `" for argument <script>, expected a file ending with .shell`},
+		{path, []string{filepath.Join(dir, "b.shell")}, `invalid value "` + filepath.Join(dir, "b.shell") + `" for argument <script>, no such file or directory`},
+		{path, []string{script + "/x.shell"}, `invalid value "` + script + `/x.shell" for argument <script>, cannot access path: not a directory`},
+	}
+
+	for _, tt := range tests {
+		_, _, err := tt.cmd.checkArgs(tt.args)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: got error %v, want %q", tt.args, err, tt.err)
+		}
+	}
+
+	if _, _, err := path.checkArgs([]string{script}); err != nil {
+		t.Errorf("%q: %v", script, err)
+	}
+}
@@ -0,0 +1,179 @@
+package gshell
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"sync"
+)
+
+type variable struct {
+	value    string
+	exported bool
+}
+
+// variables is the variable store shared by every view of a shell.
+type variables struct {
+	mu   sync.RWMutex
+	vars map[string]*variable
+}
+
+func newVariables() *variables {
+	return &variables{vars: make(map[string]*variable)}
+}
+
+// clone copies the variables, for a script running in a child scope.
+func (v *variables) clone() *variables {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	c := newVariables()
+	for name, variable := range v.vars {
+		copied := *variable
+		c.vars[name] = &copied
+	}
+	return c
+}
+
+// SetVar sets a shell variable, keeping its exported state if it already exists.
+func (sh *Shell) SetVar(name, value string) {
+	sh.vars.mu.Lock()
+	defer sh.vars.mu.Unlock()
+
+	if v, ok := sh.vars.vars[name]; ok {
+		v.value = value
+		return
+	}
+	sh.vars.vars[name] = &variable{value: value}
+}
+
+// GetVar returns the value of a shell variable, falling back to the
+// environment of the process if no shell variable with that name is set.
+// Positional parameters like 1 and special parameters like ? are also
+// returned, see isSpecialParam.
+func (sh *Shell) GetVar(name string) (string, bool) {
+	if isParamName(name) {
+		return sh.param(name)
+	}
+
+	sh.vars.mu.RLock()
+	v, ok := sh.vars.vars[name]
+	sh.vars.mu.RUnlock()
+
+	if ok {
+		return v.value, true
+	}
+	return os.LookupEnv(name)
+}
+
+func (sh *Shell) UnsetVar(name string) {
+	sh.vars.mu.Lock()
+	defer sh.vars.mu.Unlock()
+
+	delete(sh.vars.vars, name)
+}
+
+// ExportVar marks a variable to be passed in the environment of external
+// commands started by `exec`.
+func (sh *Shell) ExportVar(name string) {
+	value, _ := sh.GetVar(name)
+
+	sh.vars.mu.Lock()
+	defer sh.vars.mu.Unlock()
+
+	if v, ok := sh.vars.vars[name]; ok {
+		v.exported = true
+		return
+	}
+	sh.vars.vars[name] = &variable{value: value, exported: true}
+}
+
+// varNames returns the sorted names of the shell variables, only the
+// exported ones if exportedOnly is set.
+func (sh *Shell) varNames(exportedOnly bool) []string {
+	sh.vars.mu.RLock()
+	defer sh.vars.mu.RUnlock()
+
+	var names []string
+	for name, v := range sh.vars.vars {
+		if !exportedOnly || v.exported {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// environ returns the environment of external commands, the process
+// environment followed by the exported shell variables.
+func (sh *Shell) environ() []string {
+	env := os.Environ()
+	for _, name := range sh.varNames(true) {
+		value, _ := sh.GetVar(name)
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// lastStatus is the status, exit code and error of the last command run in
+// the foreground, shared by every view of a shell.
+type lastStatus struct {
+	mu   sync.Mutex
+	stat Status
+	code int
+	err  error
+}
+
+func newLastStatus() *lastStatus {
+	return &lastStatus{stat: OK}
+}
+
+func (l *lastStatus) set(stat Status, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stat, l.code, l.err = stat, stat.ExitCode(), err
+
+	// The code given to `return` is kept by the callers of the function
+	var retErr *returnError
+	if errors.As(err, &retErr) {
+		l.code = retErr.code
+	}
+}
+
+func (l *lastStatus) get() (Status, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stat, l.err
+}
+
+func (l *lastStatus) exitCode() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.code
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// isSpecialParam tells if $r is a special parameter: $? is the exit code of
+// the last command, $@ the positional parameters and $# their count.
+func isSpecialParam(r rune) bool {
+	return r == '?' || r == '@' || r == '#'
+}
+
+func isValidVarName(name string) bool {
+	for i, r := range name {
+		if !isNameStart(r) && (i == 0 || !isDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}